@@ -0,0 +1,143 @@
+package gobot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// -------------------------------------------------------
+
+// Authorizer decides whether user, speaking in channel, holds role
+type Authorizer interface {
+	Authorized(user, channel, role string) bool
+}
+
+// Role lists the users that hold a role.  If Channels are provided, the role only applies within
+// those channels.  A user of "*" matches everyone.
+type Role struct {
+	Users    []string `json:"users"`
+	Channels []string `json:"channels,omitempty"`
+}
+
+// Roles is an Authorizer keyed by role name, typically loaded from a json config file e.g.
+//
+//	{"deployer": {"users": ["U024BE7LH"], "channels": ["C024BE91L"]}}
+type Roles map[string]Role
+
+// LoadRoles reads Roles from the json file provided
+func LoadRoles(filename string) (Roles, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	roles := Roles{}
+	err = json.NewDecoder(f).Decode(&roles)
+	return roles, err
+}
+
+func (r Roles) Authorized(user, channel, role string) bool {
+	if role == "" {
+		return true
+	}
+
+	config, found := r[role]
+	if !found {
+		return false
+	}
+
+	if len(config.Channels) > 0 && !contains(config.Channels, channel) {
+		return false
+	}
+
+	return contains(config.Users, user) || contains(config.Users, "*")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize makes the Authorizer available to commands so they may check the Role they require
+func Authorize(authorizer Authorizer) Middleware {
+	return func(next Handler) Handler {
+		return Wrap(next, func(c *Context) (*Response, bool) {
+			c.authorizer = authorizer
+			return next.OnMessage(c)
+		})
+	}
+}
+
+// Allowed returns true if the user may run commands requiring role.  All roles are allowed when
+// no Authorizer has been configured, except to Anonymous users.
+func (c *Context) Allowed(role string) bool {
+	if c.Anonymous && role != "" {
+		return false
+	}
+	return c.allows(c.User, role)
+}
+
+func (c *Context) allows(user, role string) bool {
+	if role == "" || c.authorizer == nil {
+		return true
+	}
+	return c.authorizer.Authorized(user, c.Channel, role)
+}
+
+// -------------------------------------------------------
+
+// Verifier checks a multi-factor authentication code for a user
+type Verifier interface {
+	Verify(user, code string) error
+}
+
+// RequireMFA makes verifier available to commands marked MFA
+func RequireMFA(verifier Verifier) Middleware {
+	return func(next Handler) Handler {
+		return Wrap(next, func(c *Context) (*Response, bool) {
+			c.verifier = verifier
+			return next.OnMessage(c)
+		})
+	}
+}
+
+// mfaParam is the placeholder that holds an mfa code appended to an MFA protected command
+const mfaParam = "mfa"
+
+// verify ensures the user provided a valid mfa code, either at the end of the command or when asked
+func (c *Command) verify(ctx *Context) error {
+	if ctx.verifier == nil {
+		return fmt.Errorf("Sorry, `%s` requires an MFA code, but MFA isn't enabled", ctx.Text)
+	}
+
+	code := ctx.params[mfaParam]
+	if code != "" {
+		// keep the code out of prompts and logs
+		ctx.Text = strings.TrimSpace(strings.TrimSuffix(ctx.Text, code))
+	} else {
+		answer, err := ctx.Ask(fmt.Sprintf("`%s` requires an MFA code.  Reply with the current code from your device.", ctx.Text))
+		if err != nil {
+			return err
+		}
+		code = strings.TrimSpace(answer)
+	}
+
+	if err := ctx.verifier.Verify(ctx.User, code); err != nil {
+		log.WithFields(log.Fields{
+			"user": ctx.User,
+			"text": ctx.Text,
+		}).Warnf("mfa verification failed => %s", err.Error())
+		return fmt.Errorf("Sorry, unable to verify your MFA code => %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package gobot
+
+import (
+	"strings"
+)
+
+// -------------------------------------------------------
+
+// Status colors a block to indicate e.g. a passing or failing build
+type Status int
+
+const (
+	StatusNone Status = iota
+	StatusGood
+	StatusWarning
+	StatusDanger
+)
+
+// Symbol returns the emoji used to show the status in plain text
+func (s Status) Symbol() string {
+	switch s {
+	case StatusGood:
+		return "🟢"
+	case StatusWarning:
+		return "🟡"
+	case StatusDanger:
+		return "🔴"
+	default:
+		return ""
+	}
+}
+
+// withSymbol prefixes text with the status symbol, if any
+func (s Status) withSymbol(text string) string {
+	if symbol := s.Symbol(); symbol != "" {
+		return symbol + " " + text
+	}
+	return text
+}
+
+// -------------------------------------------------------
+
+// Block is one piece of a rich response.  Listeners that understand blocks e.g. slack render them
+// natively; everyone else receives the PlainText of each block in Response#Text.
+type Block interface {
+	PlainText() string
+}
+
+// Section is a paragraph of text with optional fields displayed beneath it
+type Section struct {
+	Text   string
+	Status Status
+	Fields []Field
+}
+
+// Field is a short name/value pair displayed within a Section
+type Field struct {
+	Name   string
+	Value  string
+	Status Status
+}
+
+func (s Section) PlainText() string {
+	lines := []string{}
+	if s.Text != "" {
+		lines = append(lines, s.Status.withSymbol(s.Text))
+	}
+	for _, f := range s.Fields {
+		lines = append(lines, f.Status.withSymbol(f.Name+": "+f.Value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Code is preformatted text e.g. a log excerpt
+type Code struct {
+	Text string
+}
+
+func (c Code) PlainText() string {
+	return "```\n" + c.Text + "\n```"
+}
+
+// Divider separates blocks
+type Divider struct{}
+
+func (d Divider) PlainText() string {
+	return "---"
+}
+
+// Buttons is a row of buttons.  Only buttons with a URL can be used from plain text listeners.
+type Buttons []Button
+
+// Button opens URL when pressed or, for listeners that support interactive buttons, runs the
+// Callback registered for Action with Value.  A button with neither runs Value as a command, as
+// if the user who pressed it had typed it.  Style, if provided, colors the button.
+type Button struct {
+	Text   string
+	URL    string
+	Action string
+	Value  string
+	Style  Status
+}
+
+func (b Buttons) PlainText() string {
+	lines := []string{}
+	for _, button := range b {
+		if button.URL != "" {
+			lines = append(lines, button.Text+": "+button.URL)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// -------------------------------------------------------
+
+// Add appends blocks to the response.  Text holds the plain text rendering of the blocks so
+// listeners that don't support blocks degrade gracefully.  Any text already in the response
+// becomes the first block.
+func (r *Response) Add(blocks ...Block) *Response {
+	if len(r.Blocks) == 0 && r.Text != "" {
+		r.Blocks = append(r.Blocks, Section{Text: r.Text})
+	}
+
+	for _, block := range blocks {
+		r.Blocks = append(r.Blocks, block)
+
+		text := block.PlainText()
+		if text == "" {
+			continue
+		}
+		if r.Text == "" {
+			r.Text = text
+		} else {
+			r.Text = r.Text + "\n" + text
+		}
+	}
+
+	return r
+}
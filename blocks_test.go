@@ -0,0 +1,49 @@
+package gobot
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBlocks(t *testing.T) {
+	Convey("Given a response with text", t, func() {
+		response := &Response{Text: "Failed builds:"}
+
+		Convey("When blocks are added", func() {
+			response.Add(
+				Section{Text: "api :: build => Failure", Status: StatusDanger},
+				Section{Fields: []Field{{Name: "web :: test", Value: "Success", Status: StatusGood}}},
+				Buttons{{Text: "Retry"}, {Text: "Open", URL: "https://go.example.com"}},
+			)
+
+			Convey("Then I expect the existing text to become the first block", func() {
+				So(len(response.Blocks), ShouldEqual, 4)
+				So(response.Blocks[0], ShouldResemble, Section{Text: "Failed builds:"})
+			})
+
+			Convey("Then I expect Text to hold the plain text rendering", func() {
+				So(response.Text, ShouldEqual, "Failed builds:\n🔴 api :: build => Failure\n🟢 web :: test: Success\nOpen: https://go.example.com")
+			})
+
+			Convey("Then I expect appended text to be added to both", func() {
+				response.Append("done")
+				So(response.Blocks[4], ShouldResemble, Section{Text: "done"})
+				So(response.Text, ShouldEndWith, "\ndone")
+			})
+		})
+	})
+
+	Convey("Given a command that says something before responding with blocks", t, func() {
+		c := &Context{}
+		c.Say("checking")
+		c.Respond("").Add(Section{Text: "all green", Status: StatusGood})
+
+		Convey("Then I expect the result to keep both", func() {
+			response, ok := c.result()
+			So(ok, ShouldBeTrue)
+			So(response.Text, ShouldEqual, "checking\n🟢 all green")
+			So(response.Blocks, ShouldResemble, []Block{Section{Text: "checking"}, Section{Text: "all green", Status: StatusGood}})
+		})
+	})
+}
@@ -0,0 +1,370 @@
+package gobot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// -------------------------------------------------------
+
+const (
+	// DefaultShutdownTimeout is how long in-flight commands are given to finish on shutdown
+	DefaultShutdownTimeout = 30 * time.Second
+
+	// DefaultStopTimeout is how long listeners are given to return once stopped
+	DefaultStopTimeout = 10 * time.Second
+
+	DefaultMinRestartDelay = time.Second
+	DefaultMaxRestartDelay = time.Minute
+)
+
+var (
+	ErrNoListeners  = errors.New("no listeners configured")
+	ErrShuttingDown = errors.New("Sorry, I'm shutting down.  Try again in a moment.")
+)
+
+// Listener connects a chat service to a Handler
+type Listener interface {
+	// Name identifies the listener in logs e.g. slack
+	Name() string
+
+	// Start delivers messages to handler, blocking until Stop is called or the listener fails.
+	// Start may be called again after it returns.
+	Start(handler Handler) error
+
+	// Stop asks the listener to disconnect; Start returns soon after
+	Stop()
+}
+
+// ListenFunc runs a listener until ctx is cancelled
+type ListenFunc func(ctx context.Context, handler Handler) error
+
+// NewListener adapts a ListenFunc to the Listener interface.  Stop cancels the context passed to fn.
+func NewListener(name string, fn ListenFunc) Listener {
+	return &listener{
+		name: name,
+		fn:   fn,
+	}
+}
+
+type listener struct {
+	name    string
+	fn      ListenFunc
+	mutex   sync.Mutex
+	cancel  context.CancelFunc
+	stopped bool
+}
+
+func (l *listener) Name() string {
+	return l.name
+}
+
+func (l *listener) Start(handler Handler) error {
+	l.mutex.Lock()
+	if l.stopped {
+		l.mutex.Unlock()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.mutex.Unlock()
+
+	defer cancel()
+	return l.fn(ctx, handler)
+}
+
+func (l *listener) Stop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.stopped = true
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
+
+// -------------------------------------------------------
+
+// Bot runs a set of listeners side by side.  Listeners that fail are restarted with exponential
+// backoff.  On shutdown, new commands are refused and background work is cancelled while both
+// finish, after which the listeners are stopped.
+type Bot struct {
+	// ShutdownTimeout defaults to DefaultShutdownTimeout
+	ShutdownTimeout time.Duration
+
+	// StopTimeout defaults to DefaultStopTimeout
+	StopTimeout time.Duration
+
+	// MinRestartDelay and MaxRestartDelay bound the backoff between restarts of a failed listener
+	MinRestartDelay time.Duration
+	MaxRestartDelay time.Duration
+
+	mutex    sync.Mutex
+	entries  []entry
+	active   int
+	draining bool
+	idle     chan struct{}
+	quit     chan struct{}
+}
+
+type entry struct {
+	listener Listener
+	handler  Handler
+}
+
+// Add registers a listener along with the handler its messages are dispatched to
+func (b *Bot) Add(listener Listener, handler Handler) {
+	b.entries = append(b.entries, entry{
+		listener: listener,
+		handler:  &tracked{Handler: handler, bot: b},
+	})
+}
+
+// Run starts the listeners and blocks until SIGINT or SIGTERM is received, or every listener has
+// exited on its own, then shuts down gracefully
+func (b *Bot) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Infof("received %s, shutting down", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return b.RunContext(ctx)
+}
+
+// RunContext is Run, but shuts down when ctx is cancelled rather than on a signal
+func (b *Bot) RunContext(ctx context.Context) error {
+	if len(b.entries) == 0 {
+		return ErrNoListeners
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, e := range b.entries {
+		wg.Add(1)
+		go func(e entry) {
+			defer wg.Done()
+			b.supervise(ctx, e)
+		}(e)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+	cancel()
+
+	// 1. let in-flight commands finish, and background work wind up, while the listeners are
+	// still connected to reply
+	log.Infof("waiting up to %v for in-flight commands to finish", b.shutdownTimeout())
+	select {
+	case <-b.drain():
+	case <-time.After(b.shutdownTimeout()):
+		log.Warnf("in-flight commands did not finish within %v", b.shutdownTimeout())
+	}
+
+	// 2. disconnect
+	for _, e := range b.entries {
+		e.listener.Stop()
+	}
+	select {
+	case <-done:
+	case <-time.After(b.stopTimeout()):
+		log.Warnf("listeners did not stop within %v", b.stopTimeout())
+	}
+
+	return nil
+}
+
+// supervise runs the listener, restarting it with backoff until ctx is cancelled or the
+// listener exits without an error
+func (b *Bot) supervise(ctx context.Context, e entry) {
+	name := e.listener.Name()
+	delay := b.minRestartDelay()
+
+	for {
+		started := time.Now()
+		err := start(e)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			log.WithField("listener", name).Infof("listener exited")
+			return
+		}
+
+		// a listener that ran for a while before failing starts its backoff over
+		if time.Now().Sub(started) > b.maxRestartDelay() {
+			delay = b.minRestartDelay()
+		}
+
+		log.WithField("listener", name).Errorf("listener failed, restarting in %v => %s", delay, err.Error())
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+
+		if delay *= 2; delay > b.maxRestartDelay() {
+			delay = b.maxRestartDelay()
+		}
+	}
+}
+
+// start converts a panicking listener into an error so it can be restarted
+func start(e entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic => %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	return e.listener.Start(e.handler)
+}
+
+func (b *Bot) begin() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.draining {
+		return false
+	}
+	b.active++
+	return true
+}
+
+// hold counts work started by a command that is already in flight, even while draining
+func (b *Bot) hold() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.active++
+}
+
+// quitting returns a channel that is closed once the bot starts shutting down
+func (b *Bot) quitting() <-chan struct{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.quit == nil {
+		b.quit = make(chan struct{})
+	}
+	return b.quit
+}
+
+func (b *Bot) end() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.active--
+	if b.active == 0 && b.idle != nil {
+		close(b.idle)
+		b.idle = nil
+	}
+}
+
+// drain refuses new commands, cancels background work, and returns a channel that is closed once
+// neither is running
+func (b *Bot) drain() <-chan struct{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.quit == nil {
+		b.quit = make(chan struct{})
+	}
+	if !b.draining {
+		close(b.quit)
+	}
+	b.draining = true
+	idle := make(chan struct{})
+	if b.active == 0 {
+		close(idle)
+	} else {
+		b.idle = idle
+	}
+	return idle
+}
+
+func (b *Bot) shutdownTimeout() time.Duration {
+	if b.ShutdownTimeout > 0 {
+		return b.ShutdownTimeout
+	}
+	return DefaultShutdownTimeout
+}
+
+func (b *Bot) stopTimeout() time.Duration {
+	if b.StopTimeout > 0 {
+		return b.StopTimeout
+	}
+	return DefaultStopTimeout
+}
+
+func (b *Bot) minRestartDelay() time.Duration {
+	if b.MinRestartDelay > 0 {
+		return b.MinRestartDelay
+	}
+	return DefaultMinRestartDelay
+}
+
+func (b *Bot) maxRestartDelay() time.Duration {
+	if b.MaxRestartDelay > 0 {
+		return b.MaxRestartDelay
+	}
+	return DefaultMaxRestartDelay
+}
+
+// -------------------------------------------------------
+
+// tracked counts the commands in flight so shutdown can wait for them
+type tracked struct {
+	Handler
+	bot *Bot
+}
+
+func (t *tracked) OnMessage(c *Context) (*Response, bool) {
+	if !t.bot.begin() {
+		// answers to questions keep in-flight commands moving, so they're still accepted
+		if t.Answer(c) {
+			return &Response{}, true
+		}
+		c.Fail(ErrShuttingDown)
+		return c.result()
+	}
+	defer t.bot.end()
+
+	c.bot = t.bot
+	return t.Handler.OnMessage(c)
+}
+
+func (t *tracked) Answer(c *Context) bool {
+	if answerer, ok := t.Handler.(Answerer); ok {
+		return answerer.Answer(c)
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package gobot
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBot(t *testing.T) {
+	Convey("Given a listener that fails twice before connecting", t, func() {
+		var starts int32
+		connected := make(chan Handler, 1)
+		listener := NewListener("flaky", func(ctx context.Context, handler Handler) error {
+			if atomic.AddInt32(&starts, 1) <= 2 {
+				return errors.New("connection refused")
+			}
+			connected <- handler
+			<-ctx.Done()
+			return nil
+		})
+
+		bot := &Bot{MinRestartDelay: time.Millisecond, MaxRestartDelay: 5 * time.Millisecond}
+		bot.Add(listener, Handlers{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- bot.RunContext(ctx) }()
+
+		Convey("Then I expect it to be restarted until it connects", func() {
+			select {
+			case <-connected:
+			case <-time.After(5 * time.Second):
+				So("timed out waiting for the listener to connect", ShouldBeEmpty)
+			}
+			So(atomic.LoadInt32(&starts), ShouldEqual, 3)
+
+			cancel()
+			So(<-done, ShouldBeNil)
+		})
+	})
+
+	Convey("Given a listener that panics", t, func() {
+		var starts int32
+		listener := NewListener("panicky", func(ctx context.Context, handler Handler) error {
+			if atomic.AddInt32(&starts, 1) == 1 {
+				panic("boom")
+			}
+			return nil
+		})
+
+		bot := &Bot{MinRestartDelay: time.Millisecond}
+		bot.Add(listener, Handlers{})
+
+		Convey("Then I expect it to be restarted, and the bot to exit once it exits cleanly", func() {
+			So(bot.RunContext(context.Background()), ShouldBeNil)
+			So(atomic.LoadInt32(&starts), ShouldEqual, 2)
+		})
+	})
+
+	Convey("Given a command in flight when the bot shuts down", t, func() {
+		release := make(chan struct{})
+		handlers := Handlers{}.WithCommands(&Command{
+			Grammar: "slow",
+			Action: func(c *Context) {
+				<-release
+				c.Respond("done")
+			},
+		})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		connected := make(chan Handler, 1)
+		var stopped int32
+		listener := NewListener("test", func(ctx context.Context, handler Handler) error {
+			connected <- handler
+			<-ctx.Done()
+			atomic.StoreInt32(&stopped, 1)
+			return nil
+		})
+
+		bot := &Bot{}
+		bot.Add(listener, handlers)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- bot.RunContext(ctx) }()
+		handler := <-connected
+
+		responses := make(chan *Response, 1)
+		go func() {
+			response, _ := handler.OnMessage(&Context{Text: "slow"})
+			responses <- response
+		}()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+
+		Convey("Then I expect new commands to be refused while it finishes", func() {
+			response, ok := handler.OnMessage(&Context{Text: "slow"})
+			So(ok, ShouldBeTrue)
+			So(response.Text, ShouldEqual, ErrShuttingDown.Error())
+			So(atomic.LoadInt32(&stopped), ShouldEqual, 0)
+
+			close(release)
+			So((<-responses).Text, ShouldEqual, "done")
+			So(<-done, ShouldBeNil)
+			So(atomic.LoadInt32(&stopped), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Given background work when the bot shuts down", t, func() {
+		handlers := Handlers{}.WithCommands(&Command{
+			Grammar: "watch",
+			Action: func(c *Context) {
+				c.Respond("watching")
+				c.Go(func(c *Context) {
+					<-c.Done()
+					c.Respond("stopped watching")
+				})
+			},
+		})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		connected := make(chan Handler, 1)
+		var stopped int32
+		listener := NewListener("test", func(ctx context.Context, handler Handler) error {
+			connected <- handler
+			<-ctx.Done()
+			atomic.StoreInt32(&stopped, 1)
+			return nil
+		})
+
+		bot := &Bot{ShutdownTimeout: 5 * time.Second}
+		bot.Add(listener, handlers)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- bot.RunContext(ctx) }()
+		handler := <-connected
+
+		sent := make(chan string, 2)
+		sender := SenderFunc(func(r *Response) error {
+			if atomic.LoadInt32(&stopped) == 0 {
+				sent <- r.Text
+			}
+			return nil
+		})
+		handler.OnMessage(&Context{Context: context.Background(), Text: "watch", Sender: sender})
+		So(<-sent, ShouldEqual, "watching")
+
+		started := time.Now()
+		cancel()
+
+		Convey("Then I expect it to be cancelled and to report before the listener stops", func() {
+			So(<-done, ShouldBeNil)
+			So(time.Now().Sub(started), ShouldBeLessThan, time.Second)
+			So(len(sent), ShouldEqual, 1)
+			So(<-sent, ShouldEqual, "stopped watching")
+		})
+	})
+
+	Convey("Given a listener that respects ctx", t, func() {
+		connected := make(chan struct{}, 1)
+		listener := NewListener("polite", func(ctx context.Context, handler Handler) error {
+			connected <- struct{}{}
+			<-ctx.Done()
+			return nil
+		})
+
+		Convey("When Stop is called directly", func() {
+			done := make(chan error, 1)
+			go func() { done <- listener.Start(Handlers{}) }()
+			<-connected
+			listener.Stop()
+
+			Convey("Then I expect Start to return promptly", func() {
+				select {
+				case err := <-done:
+					So(err, ShouldBeNil)
+				case <-time.After(time.Second):
+					So("Start did not return", ShouldBeEmpty)
+				}
+			})
+		})
+
+		Convey("When the bot shuts down", func() {
+			bot := &Bot{}
+			bot.Add(listener, Handlers{})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- bot.RunContext(ctx) }()
+			<-connected
+
+			started := time.Now()
+			cancel()
+
+			Convey("Then I expect it to return well within the stop timeout", func() {
+				select {
+				case err := <-done:
+					So(err, ShouldBeNil)
+					So(time.Since(started), ShouldBeLessThan, time.Second)
+				case <-time.After(DefaultStopTimeout):
+					So("RunContext did not return", ShouldBeEmpty)
+				}
+			})
+		})
+	})
+
+	Convey("Given a listener that ignores ctx", t, func() {
+		connected := make(chan struct{}, 1)
+		release := make(chan struct{})
+		defer close(release)
+		listener := NewListener("stubborn", func(ctx context.Context, handler Handler) error {
+			connected <- struct{}{}
+			<-release
+			return nil
+		})
+
+		bot := &Bot{StopTimeout: 50 * time.Millisecond}
+		bot.Add(listener, Handlers{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- bot.RunContext(ctx) }()
+		<-connected
+		cancel()
+
+		Convey("Then I expect the bot to give up on it after the stop timeout", func() {
+			select {
+			case err := <-done:
+				So(err, ShouldBeNil)
+			case <-time.After(5 * time.Second):
+				So("RunContext did not return", ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("Given a bot without listeners", t, func() {
+		Convey("Then I expect Run to fail", func() {
+			So((&Bot{}).RunContext(context.Background()), ShouldEqual, ErrNoListeners)
+		})
+	})
+}
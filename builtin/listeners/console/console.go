@@ -0,0 +1,184 @@
+package console
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/peterh/liner"
+	"github.com/savaki/gobot"
+)
+
+const (
+	// HistoryFile, within the user's home directory, holds previously entered commands
+	HistoryFile = ".gobot_history"
+)
+
+// Listen reads commands from stdin, with line editing and history, and dispatches them to the
+// handler.  Text responses are printed to stdout and attachments are saved to dir.  Listen returns
+// when stdin is closed, the user presses ctrl-c, or ctx is done.
+func Listen(ctx context.Context, name string, handler gobot.Handler, dir string) error {
+	log.WithField("provider", "console").Debugf("starting console listener with name, %s", name)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "console"
+	}
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+
+	history := filepath.Join(os.Getenv("HOME"), HistoryFile)
+	if f, err := os.Open(history); err == nil {
+		line.ReadHistory(f)
+		f.Close()
+	}
+	defer func() {
+		if f, err := os.Create(history); err == nil {
+			line.WriteHistory(f)
+			f.Close()
+		}
+	}()
+
+	r := &repl{
+		ctx:     ctx,
+		name:    name,
+		user:    user,
+		dir:     dir,
+		handler: handler,
+		out:     os.Stdout,
+	}
+
+	fmt.Printf("Type `help` for the list of commands, ctrl-d to exit\n")
+	return r.run(line, line.AppendHistory)
+}
+
+// Listener returns the console listener for use with gobot.Bot
+func Listener(name, dir string) gobot.Listener {
+	return gobot.NewListener("console", func(ctx context.Context, handler gobot.Handler) error {
+		return Listen(ctx, name, handler, dir)
+	})
+}
+
+// prompter reads a line of input; implemented by liner.State
+type prompter interface {
+	Prompt(prompt string) (string, error)
+}
+
+type repl struct {
+	ctx     context.Context
+	name    string
+	user    string
+	dir     string
+	handler gobot.Handler
+	out     io.Writer
+	mutex   sync.Mutex
+}
+
+type input struct {
+	text string
+	err  error
+}
+
+// run dispatches each line read from p until the input ends or ctx is done.  Prompting blocks on
+// stdin, so it happens in the background, leaving run free to return as soon as ctx is done.
+func (r *repl) run(p prompter, history func(string)) error {
+	lines := make(chan input)
+	go func() {
+		for {
+			text, err := p.Prompt(r.name + "> ")
+			select {
+			case lines <- input{text: text, err: err}:
+			case <-r.ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var in input
+		select {
+		case <-r.ctx.Done():
+			return nil
+		case in = <-lines:
+		}
+
+		if in.err == liner.ErrPromptAborted || in.err == io.EOF {
+			return nil
+		} else if in.err != nil {
+			return in.err
+		}
+
+		text := strings.TrimSpace(in.text)
+		if text == "" {
+			continue
+		}
+		history(text)
+
+		// allow the bot name prefix out of habit
+		text = strings.TrimSpace(strings.TrimPrefix(text, r.name+" "))
+
+		// dispatch in the background so commands may ask follow up questions
+		go r.dispatch(text)
+	}
+}
+
+func (r *repl) dispatch(text string) {
+	ctx := &gobot.Context{
+		Context: r.ctx,
+		User:    r.user,
+		Channel: "console",
+		Text:    text,
+		Private: true,
+		Sender:  gobot.SenderFunc(r.respond),
+	}
+
+	if response, ok := r.handler.OnMessage(ctx); ok {
+		if err := r.respond(response); err != nil {
+			log.WithField("provider", "console").Warnf("unable to respond to '%s' => %s", text, err.Error())
+		}
+	}
+}
+
+func (r *repl) respond(response *gobot.Response) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if response.Text != "" {
+		fmt.Fprintln(r.out, response.Text)
+	}
+
+	for _, a := range response.Attachments {
+		filename := filepath.Join(r.dir, filepath.Base(a.Filename))
+		if err := save(filename, a.Content); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "[%s saved to %s]\n", a.Title, filename)
+	}
+
+	return nil
+}
+
+func save(filename string, content io.Reader) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, content)
+	return err
+}
@@ -0,0 +1,140 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// lines prompts by reading lines from r
+type lines struct {
+	reader *bufio.Reader
+}
+
+func (l lines) Prompt(prompt string) (string, error) {
+	text, err := l.reader.ReadString('\n')
+	if err != nil && text == "" {
+		return "", err
+	}
+	return text, nil
+}
+
+// output collects what the repl prints from several goroutines
+type output struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.buffer.Write(p)
+}
+
+func (o *output) String() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.buffer.String()
+}
+
+func eventually(fn func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if fn() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestRepl(t *testing.T) {
+	Convey("Given a repl", t, func() {
+		dir, err := ioutil.TempDir("", "gobot-console")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+
+		mutex := &sync.Mutex{}
+		received := []*gobot.Context{}
+		handler := gobot.Handlers{}.WithCommands(
+			&gobot.Command{
+				Grammar: "hello",
+				Action: func(c *gobot.Context) {
+					mutex.Lock()
+					received = append(received, c)
+					mutex.Unlock()
+					c.Respond("hello " + c.User)
+				},
+			},
+			&gobot.Command{
+				Grammar: "qr",
+				Action: func(c *gobot.Context) {
+					c.Upload(gobot.Attachment{Title: "QR Code", Filename: "../QR.png", Content: strings.NewReader("png")})
+				},
+			},
+		)
+		So(handler.OnLoad(), ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		Reset(cancel)
+
+		out := &output{}
+		r := &repl{ctx: ctx, name: "gobot", user: "matt", dir: dir, handler: handler, out: out}
+		history := []string{}
+
+		Convey("When commands are typed and the input ends", func() {
+			input := "hello\n\ngobot hello\nqr\n"
+			err := r.run(lines{bufio.NewReader(strings.NewReader(input))}, func(text string) { history = append(history, text) })
+
+			Convey("Then each command is dispatched, with or without the bot name", func() {
+				So(err, ShouldBeNil)
+				So(history, ShouldResemble, []string{"hello", "gobot hello", "qr"})
+				So(eventually(func() bool { return strings.Count(out.String(), "hello matt") == 2 }), ShouldBeTrue)
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				So(received[0].Private, ShouldBeTrue)
+				So(received[0].Channel, ShouldEqual, "console")
+			})
+
+			Convey("Then attachments are saved within dir", func() {
+				filename := filepath.Join(dir, "QR.png")
+				So(eventually(func() bool { return strings.Contains(out.String(), "[QR Code saved to "+filename+"]") }), ShouldBeTrue)
+
+				data, err := ioutil.ReadFile(filename)
+				So(err, ShouldBeNil)
+				So(string(data), ShouldEqual, "png")
+			})
+		})
+
+		Convey("When ctx is done while waiting for input", func() {
+			reader, writer := io.Pipe()
+			defer writer.Close()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- r.run(lines{bufio.NewReader(reader)}, func(string) {})
+			}()
+			cancel()
+
+			Convey("Then run returns without waiting on the input", func() {
+				select {
+				case err := <-done:
+					So(err, ShouldBeNil)
+				case <-time.After(time.Second):
+					So("run did not return", ShouldBeEmpty)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,315 @@
+package httpbot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+)
+
+const (
+	DefaultAddr = ":8080"
+
+	// ShutdownTimeout is how long in-flight requests are given to complete on shutdown
+	ShutdownTimeout = 30 * time.Second
+
+	// MaxRequestSize limits the size of request bodies
+	MaxRequestSize = 64 * 1024
+
+	// DefaultChannel is the channel commands run in when the token doesn't name one
+	DefaultChannel = "http"
+)
+
+// Request is the json body POSTed to run a command.  The user and channel are determined by the
+// bearer token rather than the request.
+type Request struct {
+	Text string `json:"text"`
+}
+
+// Response is the json returned from running a command
+type Response struct {
+	Ok          bool         `json:"ok"`
+	Text        string       `json:"text,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// Attachment holds a base64 encoded gobot.Attachment
+type Attachment struct {
+	Title       string `json:"title,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Content     string `json:"content,omitempty"`
+}
+
+// Client describes who is using a bearer token
+type Client struct {
+	Name string
+
+	// Channel is the channel the client's commands run in, which roles may be limited to
+	Channel string
+
+	// Confirm, if true, lets the client confirm its own commands.  Commands that require
+	// confirmation are otherwise refused, as there's no one to ask.
+	Confirm bool
+}
+
+// Tokens maps each bearer token to the client using it
+type Tokens map[string]Client
+
+// ParseTokens parses a comma separated list of name:token pairs e.g. ci:abc123,deploy:def456.  The
+// name may be followed by @channel to run the client's commands in that channel rather than
+// DefaultChannel, and by +confirm to let the client confirm its own commands e.g.
+// ci@deploys+confirm:abc123
+func ParseTokens(text string) (Tokens, error) {
+	tokens := Tokens{}
+
+	for i, pair := range strings.Split(text, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		// never echo the pair itself; it may be a token
+		segments := strings.SplitN(pair, ":", 2)
+		if len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+			return nil, fmt.Errorf("invalid token at position %d; expected name:token", i+1)
+		}
+		client, err := parseClient(segments[0])
+		if err != nil {
+			return nil, err
+		}
+		if existing, found := tokens[segments[1]]; found {
+			return nil, fmt.Errorf("token for %s is already used by %s", client.Name, existing.Name)
+		}
+		tokens[segments[1]] = client
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens defined; expected name:token,...")
+	}
+	return tokens, nil
+}
+
+// parseClient parses the name[@channel][+confirm] half of a name:token pair
+func parseClient(text string) (Client, error) {
+	options := strings.Split(text, "+")
+	client := Client{Name: options[0], Channel: DefaultChannel}
+
+	for _, option := range options[1:] {
+		if option != "confirm" {
+			return Client{}, fmt.Errorf("unknown option, %s, for %s; expected confirm", option, client.Name)
+		}
+		client.Confirm = true
+	}
+
+	if segments := strings.SplitN(client.Name, "@", 2); len(segments) == 2 {
+		if segments[1] == "" {
+			return Client{}, fmt.Errorf("missing channel for %s; expected name@channel", segments[0])
+		}
+		client.Name, client.Channel = segments[0], segments[1]
+	}
+	if client.Name == "" {
+		return Client{}, fmt.Errorf("missing name; expected name:token")
+	}
+
+	return client, nil
+}
+
+// Listen serves the handler over http on addr until ctx is cancelled.  Requests must provide one
+// of the tokens in GOBOT_HTTP_TOKENS, as parsed by ParseTokens, as a bearer token.  Commands run as
+// the user http:<name> in the token's channel.
+func Listen(ctx context.Context, addr string, handler gobot.Handler) error {
+	log.WithField("provider", "httpbot").Debugf("starting http listener on %s", addr)
+
+	text := os.Getenv("GOBOT_HTTP_TOKENS")
+	if text == "" {
+		return fmt.Errorf("ERROR - missing env variable, GOBOT_HTTP_TOKENS")
+	}
+	tokens, err := ParseTokens(text)
+	if err != nil {
+		return fmt.Errorf("ERROR - invalid env variable, GOBOT_HTTP_TOKENS => %s", err.Error())
+	}
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: Handler(ctx, tokens, handler),
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		timeout, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		server.Shutdown(timeout)
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Listener returns the http listener for use with gobot.Bot
+func Listener(addr string) gobot.Listener {
+	return gobot.NewListener("http", func(ctx context.Context, handler gobot.Handler) error {
+		return Listen(ctx, addr, handler)
+	})
+}
+
+// Handler returns an http.Handler that runs POSTed commands against handler.  Responses are json
+// with base64 encoded attachments unless the client Accepts multipart/mixed, in which case each
+// attachment is sent as its own part following the json.
+//
+// There's no way to ask the client a follow up question, so commands that require confirmation
+// are refused unless the token's client may confirm its own.  The client is then recorded as the
+// confirmer, and still needs any role the confirmation requires.
+func Handler(ctx context.Context, tokens Tokens, handler gobot.Handler) http.Handler {
+	return &server{
+		ctx:     ctx,
+		tokens:  tokens,
+		handler: handler,
+	}
+}
+
+type server struct {
+	ctx     context.Context
+	tokens  Tokens
+	handler gobot.Handler
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+
+	client, ok := s.authorize(req)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+		return
+	}
+
+	in := Request{}
+	if err := json.NewDecoder(io.LimitReader(req.Body, MaxRequestSize)).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unable to parse request => %s", err.Error()))
+		return
+	}
+	if strings.TrimSpace(in.Text) == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+
+	log.WithField("provider", "httpbot").Debugf("[IN]  => %s", in.Text)
+	ctx := &gobot.Context{
+		Context: s.ctx,
+		User:    "http:" + client.Name,
+		Channel: client.Channel,
+		Text:    strings.TrimSpace(in.Text),
+	}
+	if client.Confirm {
+		ctx.Confirmer = ctx.User
+	}
+
+	response, ok := s.handler.OnMessage(ctx)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no command matched, %s", in.Text))
+		return
+	}
+
+	if strings.Contains(req.Header.Get("Accept"), "multipart/mixed") {
+		writeMultipart(w, response)
+		return
+	}
+
+	out := Response{
+		Ok:   true,
+		Text: response.Text,
+	}
+	for _, a := range response.Attachments {
+		data, err := ioutil.ReadAll(a.Content)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		out.Attachments = append(out.Attachments, Attachment{
+			Title:       a.Title,
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Content:     base64.StdEncoding.EncodeToString(data),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// authorize returns the client whose token was provided
+func (s *server) authorize(req *http.Request) (Client, bool) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return Client{}, false
+	}
+
+	token := strings.TrimPrefix(auth, "Bearer ")
+	client, found := Client{}, false
+	for candidate, c := range s.tokens {
+		// compare against every token so the time taken doesn't reveal which was close
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			client, found = c, true
+		}
+	}
+	return client, found
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, Response{Error: message})
+}
+
+func writeMultipart(w http.ResponseWriter, response *gobot.Response) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json"}})
+	if err != nil {
+		return
+	}
+	json.NewEncoder(part).Encode(Response{Ok: true, Text: response.Text})
+
+	for _, a := range response.Attachments {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", a.ContentType)
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, a.Filename))
+		header.Set("Content-Description", a.Title)
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return
+		}
+		if _, err := io.Copy(part, a.Content); err != nil {
+			log.WithField("provider", "httpbot").Warnf("unable to write attachment, %s => %s", a.Filename, err.Error())
+			return
+		}
+	}
+
+	mw.Close()
+}
@@ -0,0 +1,199 @@
+package httpbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseTokens(t *testing.T) {
+	Convey("Given name:token pairs", t, func() {
+		tokens, err := ParseTokens("ci:abc123, deploy:def456")
+
+		Convey("Then I expect each token to map to its name", func() {
+			So(err, ShouldBeNil)
+			So(tokens, ShouldResemble, Tokens{
+				"abc123": {Name: "ci", Channel: DefaultChannel},
+				"def456": {Name: "deploy", Channel: DefaultChannel},
+			})
+		})
+	})
+
+	Convey("Given names with a channel and confirmation", t, func() {
+		tokens, err := ParseTokens("ci@deploys+confirm:abc123,deploy+confirm:def456")
+
+		Convey("Then I expect each client to carry them", func() {
+			So(err, ShouldBeNil)
+			So(tokens, ShouldResemble, Tokens{
+				"abc123": {Name: "ci", Channel: "deploys", Confirm: true},
+				"def456": {Name: "deploy", Channel: DefaultChannel, Confirm: true},
+			})
+		})
+	})
+
+	Convey("Given invalid pairs", t, func() {
+		Convey("Then I expect each to be rejected without echoing the token", func() {
+			for _, text := range []string{"", "abc123", "ci:", ":abc123", "ci:abc123,deploy:abc123", "ci@:abc123", "ci+approve:abc123", "@deploys:abc123"} {
+				_, err := ParseTokens(text)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldNotContainSubstring, "abc123")
+			}
+		})
+	})
+}
+
+func TestHandler(t *testing.T) {
+	Convey("Given an http listener", t, func() {
+		var received *gobot.Context
+		handlers := gobot.Handlers{}.WithCommands(
+			&gobot.Command{
+				Grammar: "hello <name>",
+				Action: func(c *gobot.Context) {
+					received = c
+					c.Respond("hello " + c.String("name") + " from " + c.User)
+					c.Upload(gobot.Attachment{
+						Title:       "Greeting",
+						Filename:    "greeting.txt",
+						Content:     strings.NewReader("hi"),
+						ContentType: "text/plain",
+					})
+				},
+			},
+			&gobot.Command{
+				Grammar: "deploy",
+				Summary: "deploy",
+				Confirm: gobot.ConfirmSelf,
+				Action:  func(c *gobot.Context) { c.Respond("deployed, confirmed by " + c.ConfirmedBy) },
+			},
+		)
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		tokens := Tokens{
+			"secret":  {Name: "ci", Channel: DefaultChannel},
+			"trusted": {Name: "deploy", Channel: "deploys", Confirm: true},
+		}
+		server := httptest.NewServer(Handler(context.Background(), tokens, handlers))
+		defer server.Close()
+
+		request := func(token, body, accept string) *http.Response {
+			req, _ := http.NewRequest("POST", server.URL, bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			return resp
+		}
+
+		post := func(token, body string) (*http.Response, Response) {
+			resp := request(token, body, "")
+			defer resp.Body.Close()
+
+			out := Response{}
+			So(json.NewDecoder(resp.Body).Decode(&out), ShouldBeNil)
+			return resp, out
+		}
+
+		Convey("When a command is POSTed", func() {
+			resp, out := post("secret", `{"text":"hello world"}`)
+
+			Convey("Then I expect the response as json", func() {
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+				So(out.Ok, ShouldBeTrue)
+				So(out.Text, ShouldEqual, "hello world from http:ci")
+				So(len(out.Attachments), ShouldEqual, 1)
+				So(out.Attachments[0].Title, ShouldEqual, "Greeting")
+				So(out.Attachments[0].Filename, ShouldEqual, "greeting.txt")
+				So(out.Attachments[0].ContentType, ShouldEqual, "text/plain")
+				So(out.Attachments[0].Content, ShouldEqual, base64.StdEncoding.EncodeToString([]byte("hi")))
+			})
+
+			Convey("Then I expect the command not to be treated as private", func() {
+				So(received.Private, ShouldBeFalse)
+				So(received.Channel, ShouldEqual, "http")
+			})
+		})
+
+		Convey("When the request names a user and channel", func() {
+			_, out := post("trusted", `{"user":"admin","channel":"ops","text":"hello world"}`)
+
+			Convey("Then I expect the token's identity and channel to be used regardless", func() {
+				So(out.Text, ShouldEqual, "hello world from http:deploy")
+				So(received.Channel, ShouldEqual, "deploys")
+			})
+		})
+
+		Convey("When the client accepts multipart/mixed", func() {
+			resp := request("secret", `{"text":"hello world"}`, "multipart/mixed")
+			defer resp.Body.Close()
+
+			mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+			So(err, ShouldBeNil)
+			So(mediaType, ShouldEqual, "multipart/mixed")
+
+			reader := multipart.NewReader(resp.Body, params["boundary"])
+
+			Convey("Then I expect the json followed by each attachment as its own part", func() {
+				part, err := reader.NextPart()
+				So(err, ShouldBeNil)
+				So(part.Header.Get("Content-Type"), ShouldEqual, "application/json")
+				out := Response{}
+				So(json.NewDecoder(part).Decode(&out), ShouldBeNil)
+				So(out.Text, ShouldEqual, "hello world from http:ci")
+				So(out.Attachments, ShouldBeEmpty)
+
+				part, err = reader.NextPart()
+				So(err, ShouldBeNil)
+				So(part.Header.Get("Content-Type"), ShouldEqual, "text/plain")
+				So(part.Header.Get("Content-Description"), ShouldEqual, "Greeting")
+				So(part.FileName(), ShouldEqual, "greeting.txt")
+				data, err := ioutil.ReadAll(part)
+				So(err, ShouldBeNil)
+				So(string(data), ShouldEqual, "hi")
+
+				_, err = reader.NextPart()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a command requires confirmation", func() {
+			_, out := post("secret", `{"text":"deploy"}`)
+
+			Convey("Then I expect it to be refused with an explanation", func() {
+				So(out.Text, ShouldEqual, "Sorry, `deploy` must be confirmed, which isn't possible from here.  Run it from chat instead.")
+			})
+		})
+
+		Convey("When a client that may confirm its own commands sends one that requires confirmation", func() {
+			_, out := post("trusted", `{"text":"deploy"}`)
+
+			Convey("Then I expect it to run, confirmed by the client", func() {
+				So(out.Text, ShouldEqual, "deployed, confirmed by http:deploy")
+			})
+		})
+
+		Convey("When no command matches", func() {
+			resp, out := post("secret", `{"text":"goodbye"}`)
+			So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+			So(out.Ok, ShouldBeFalse)
+		})
+
+		Convey("When the token is wrong", func() {
+			resp, out := post("guess", `{"text":"hello world"}`)
+			So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+			So(out.Text, ShouldEqual, "")
+		})
+	})
+}
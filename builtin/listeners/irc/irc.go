@@ -0,0 +1,377 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+)
+
+const (
+	// FloodDelay is the minimum delay between lines sent to the server
+	FloodDelay = 700 * time.Millisecond
+
+	// MaxLineLength keeps each message comfortably within the 512 byte irc limit once the
+	// command and target are added
+	MaxLineLength = 400
+)
+
+// floodDelay is FloodDelay; tests shorten it
+var floodDelay = FloodDelay
+
+// Listen connects to the irc server in GOBOT_IRC_SERVER (host:port), joins the comma separated
+// GOBOT_IRC_CHANNELS, and dispatches messages addressed to name to the handler.  Set GOBOT_IRC_TLS
+// to true to connect using tls and GOBOT_IRC_PASSWORD if the server requires a password.
+//
+// Anyone can take a nick, so users are identified by the services account they're logged in to,
+// which the server must report using the IRCv3 account-tag capability.  Nicks that aren't logged
+// in run commands as ~nick and are Anonymous, so they're refused anything restricted.
+func Listen(ctx context.Context, name string, handler gobot.Handler) error {
+	log.WithField("provider", "irc").Debugf("starting irc listener with name, %s", name)
+
+	// 1. connect to the server
+	server := os.Getenv("GOBOT_IRC_SERVER")
+	if server == "" {
+		return fmt.Errorf("ERROR - missing env variable, GOBOT_IRC_SERVER")
+	}
+
+	var conn net.Conn
+	var err error
+	if os.Getenv("GOBOT_IRC_TLS") == "true" {
+		conn, err = tls.Dial("tcp", server, &tls.Config{})
+	} else {
+		conn, err = net.Dial("tcp", server)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	channels := strings.Split(os.Getenv("GOBOT_IRC_CHANNELS"), ",")
+	return serve(ctx, conn, name, os.Getenv("GOBOT_IRC_PASSWORD"), channels, handler)
+}
+
+// serve registers with the server over conn and dispatches messages until the connection fails
+// or ctx is done
+func serve(ctx context.Context, conn net.Conn, name, password string, channels []string, handler gobot.Handler) error {
+	// 2. create a matcher for the name
+	pattern := fmt.Sprintf(`^\s*%s[:,]?\s+(.*)$`, regexp.QuoteMeta(name))
+	matcher, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	// done stops the background goroutines when this connection ends, so they don't pile up
+	// across reconnects
+	done := make(chan struct{})
+	defer close(done)
+
+	r := &robot{
+		ctx:      ctx,
+		conn:     conn,
+		nick:     name,
+		matcher:  matcher,
+		handler:  handler,
+		channels: channels,
+		outbox:   make(chan string, 256),
+		done:     done,
+	}
+	go r.writeLoop()
+
+	// 3. register and listen; registration waits for CAP END once the capability is requested
+	r.send("CAP REQ :account-tag")
+	if password != "" {
+		r.send("PASS " + password)
+	}
+	r.send("NICK " + name)
+	r.send(fmt.Sprintf("USER %s 0 * :%s", name, name))
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			// bypass the flood queue; the connection closes before the queue would get to it
+			conn.SetWriteDeadline(time.Now().Add(FloodDelay))
+			fmt.Fprintf(conn, "QUIT :shutting down\r\n")
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	err = r.readLoop()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// Listener returns the irc listener for use with gobot.Bot
+func Listener(name string) gobot.Listener {
+	return gobot.NewListener("irc", func(ctx context.Context, handler gobot.Handler) error {
+		return Listen(ctx, name, handler)
+	})
+}
+
+type robot struct {
+	ctx      context.Context
+	conn     net.Conn
+	nick     string
+	matcher  *regexp.Regexp
+	handler  gobot.Handler
+	channels []string
+	outbox   chan string
+	done     chan struct{}
+}
+
+// message is a single parsed line from the server
+type message struct {
+	tags    map[string]string
+	prefix  string
+	command string
+	params  []string
+}
+
+func (m message) nick() string {
+	if i := strings.Index(m.prefix, "!"); i > 0 {
+		return m.prefix[0:i]
+	}
+	return m.prefix
+}
+
+func parse(line string) message {
+	m := message{tags: map[string]string{}}
+
+	if strings.HasPrefix(line, "@") {
+		tags := line[1:]
+		if i := strings.Index(line, " "); i > 0 {
+			tags, line = line[1:i], strings.TrimLeft(line[i+1:], " ")
+		} else {
+			line = ""
+		}
+		for _, tag := range strings.Split(tags, ";") {
+			segments := strings.SplitN(tag, "=", 2)
+			if len(segments) == 2 {
+				m.tags[segments[0]] = tagEscapes.Replace(segments[1])
+			} else {
+				m.tags[segments[0]] = ""
+			}
+		}
+	}
+
+	if strings.HasPrefix(line, ":") {
+		if i := strings.Index(line, " "); i > 0 {
+			m.prefix, line = line[1:i], line[i+1:]
+		}
+	}
+
+	trailing := ""
+	hasTrailing := false
+	if i := strings.Index(line, " :"); i >= 0 {
+		line, trailing, hasTrailing = line[0:i], line[i+2:], true
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		m.command, m.params = strings.ToUpper(fields[0]), fields[1:]
+	}
+	if hasTrailing {
+		m.params = append(m.params, trailing)
+	}
+
+	return m
+}
+
+// tagEscapes unescapes message tag values
+var tagEscapes = strings.NewReplacer(`\:`, ";", `\s`, " ", `\\`, `\`, `\r`, "\r", `\n`, "\n")
+
+func (r *robot) readLoop() error {
+	reader := bufio.NewReader(r.conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return fmt.Errorf("irc server closed the connection")
+		} else if err != nil {
+			return err
+		}
+
+		m := parse(strings.TrimRight(line, "\r\n"))
+		switch m.command {
+		case "PING":
+			// bypass the flood queue so a backlog of replies can't get us disconnected
+			fmt.Fprintf(r.conn, "PONG :%s\r\n", strings.Join(m.params, " "))
+
+		case "CAP":
+			if len(m.params) < 3 {
+				break
+			}
+			switch m.params[1] {
+			case "ACK":
+				r.send("CAP END")
+			case "NAK":
+				log.WithField("provider", "irc").Warnf("irc server doesn't support account-tag; every user will be anonymous")
+				r.send("CAP END")
+			}
+
+		case "001":
+			// welcome; safe to join our channels now
+			for _, channel := range r.channels {
+				if channel = strings.TrimSpace(channel); channel != "" {
+					r.send("JOIN " + channel)
+				}
+			}
+
+		case "433":
+			return fmt.Errorf("irc nick, %s, is already in use", r.nick)
+
+		case "PRIVMSG":
+			if len(m.params) == 2 {
+				r.onMessage(m.nick(), m.tags["account"], m.params[0], m.params[1])
+			}
+		}
+	}
+}
+
+// onMessage handles a PRIVMSG from nick, who is logged in to account, or to no account if empty
+func (r *robot) onMessage(nick, account, target, text string) {
+	log.WithField("provider", "irc").Debugf("[RAW] => %s", text)
+
+	// the ~ keeps a nick that isn't logged in from passing for the account of the same name,
+	// including when answering questions asked of that account
+	user, anonymous := account, account == "" || account == "*"
+	if anonymous {
+		user = "~" + nick
+	}
+
+	// private messages are replied to privately and need no name prefix
+	private := !strings.HasPrefix(target, "#") && !strings.HasPrefix(target, "&")
+	channel := target
+	if private {
+		channel = nick
+	}
+
+	if private {
+		go r.dispatch(r.newContext(user, channel, private, anonymous, strings.TrimSpace(text)))
+
+	} else if matches := r.matcher.FindStringSubmatch(text); len(matches) > 1 {
+		go r.dispatch(r.newContext(user, channel, private, anonymous, strings.TrimSpace(matches[1])))
+
+	} else if answerer, ok := r.handler.(gobot.Answerer); ok {
+		// not addressed to us, but it may be the answer to a question we asked
+		answerer.Answer(r.newContext(user, channel, private, anonymous, strings.TrimSpace(text)))
+	}
+}
+
+func (r *robot) newContext(user, channel string, private, anonymous bool, text string) *gobot.Context {
+	return &gobot.Context{
+		Context:   r.ctx,
+		User:      user,
+		Channel:   channel,
+		Text:      text,
+		Private:   private,
+		Anonymous: anonymous,
+		Sender: gobot.SenderFunc(func(response *gobot.Response) error {
+			return r.respond(channel, response)
+		}),
+	}
+}
+
+func (r *robot) dispatch(ctx *gobot.Context) {
+	log.WithField("provider", "irc").Debugf("[IN]  => %s", ctx.Text)
+	if response, ok := r.handler.OnMessage(ctx); ok {
+		r.respond(ctx.Channel, response)
+	}
+}
+
+// respond splits the text into one PRIVMSG per line.  Attachments can't be sent over irc, so we
+// send a notice in their place
+func (r *robot) respond(target string, response *gobot.Response) error {
+	for _, line := range lines(response.Text) {
+		for _, chunk := range split(line, MaxLineLength) {
+			r.send(fmt.Sprintf("PRIVMSG %s :%s", target, chunk))
+		}
+	}
+
+	for _, a := range response.Attachments {
+		r.send(fmt.Sprintf("NOTICE %s :[%s (%s) can't be displayed on irc]", target, oneLine(a.Title), oneLine(a.Filename)))
+	}
+
+	return nil
+}
+
+// lines splits text on both \r and \n; the server treats either as the end of a command, so
+// leaving one in a line would let echoed text inject commands of its own
+func lines(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return r == '\r' || r == '\n'
+	})
+}
+
+func oneLine(text string) string {
+	return strings.Join(lines(text), " ")
+}
+
+// split breaks line into chunks of at most n bytes, preferring to break on spaces
+func split(line string, n int) []string {
+	chunks := []string{}
+	for len(line) > n {
+		i := strings.LastIndex(line[0:n], " ")
+		if i <= 0 {
+			// no space to break on; avoid splitting a multi-byte character
+			for i = n; i > 0 && !utf8.RuneStart(line[i]); i-- {
+			}
+		}
+		chunks = append(chunks, line[0:i])
+		line = strings.TrimLeft(line[i:], " ")
+	}
+	if strings.TrimSpace(line) != "" {
+		chunks = append(chunks, line)
+	}
+	return chunks
+}
+
+func (r *robot) send(line string) {
+	select {
+	case r.outbox <- line:
+	default:
+		log.WithField("provider", "irc").Warnf("outbox full, dropping => %s", line)
+	}
+}
+
+// writeLoop sends queued lines no faster than FloodDelay so the server doesn't disconnect us.  It
+// returns once the connection is done.
+func (r *robot) writeLoop() {
+	ticker := time.NewTicker(floodDelay)
+	defer ticker.Stop()
+
+	for {
+		var line string
+		select {
+		case line = <-r.outbox:
+		case <-r.done:
+			return
+		}
+
+		if strings.HasPrefix(line, "PRIVMSG") {
+			log.WithField("provider", "irc").Debugf("[OUT] => %s", line)
+		}
+		if _, err := fmt.Fprintf(r.conn, "%s\r\n", line); err != nil {
+			log.WithField("provider", "irc").Warnf("unable to write to irc server => %s", err.Error())
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Given a line with a prefix and trailing param", t, func() {
+		m := parse(":matt!m@example.com PRIVMSG #ops :gobot: deploy api")
+
+		Convey("Then the trailing param keeps its spaces", func() {
+			So(m.prefix, ShouldEqual, "matt!m@example.com")
+			So(m.nick(), ShouldEqual, "matt")
+			So(m.command, ShouldEqual, "PRIVMSG")
+			So(m.params, ShouldResemble, []string{"#ops", "gobot: deploy api"})
+		})
+	})
+
+	Convey("Given a line with message tags", t, func() {
+		m := parse("@account=matt;time=2016-01-01T00:00:00.000Z;msgid=a\\sb :matt!m@example.com PRIVMSG #ops :hi")
+
+		Convey("Then the tags are parsed ahead of the prefix", func() {
+			So(m.tags["account"], ShouldEqual, "matt")
+			So(m.tags["msgid"], ShouldEqual, "a b")
+			So(m.prefix, ShouldEqual, "matt!m@example.com")
+			So(m.command, ShouldEqual, "PRIVMSG")
+			So(m.params, ShouldResemble, []string{"#ops", "hi"})
+		})
+	})
+
+	Convey("Given a line without a prefix", t, func() {
+		m := parse("PING :irc.example.com")
+
+		Convey("Then the command comes first", func() {
+			So(m.prefix, ShouldEqual, "")
+			So(m.command, ShouldEqual, "PING")
+			So(m.params, ShouldResemble, []string{"irc.example.com"})
+		})
+	})
+
+	Convey("Given a line without a trailing param", t, func() {
+		m := parse(":irc.example.com 433 * gobot")
+
+		Convey("Then each param is split on spaces", func() {
+			So(m.command, ShouldEqual, "433")
+			So(m.params, ShouldResemble, []string{"*", "gobot"})
+		})
+	})
+}
+
+func TestSplit(t *testing.T) {
+	Convey("Given a line longer than the limit", t, func() {
+		Convey("Then it is split on the last space", func() {
+			So(split("the quick brown fox", 10), ShouldResemble, []string{"the quick", "brown fox"})
+		})
+	})
+
+	Convey("Given a line with no spaces", t, func() {
+		Convey("Then multi-byte characters are never split", func() {
+			chunks := split("ééééé", 5)
+			So(chunks, ShouldResemble, []string{"éé", "éé", "é"})
+		})
+	})
+
+	Convey("Given a blank line", t, func() {
+		Convey("Then nothing is sent", func() {
+			So(split("   ", 10), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestLines(t *testing.T) {
+	Convey("Given text with carriage returns", t, func() {
+		Convey("Then they split lines just like newlines", func() {
+			So(lines("hello\r\nQUIT :bye\rJOIN #evil\n"), ShouldResemble, []string{"hello", "QUIT :bye", "JOIN #evil"})
+			So(oneLine("qr\r\ncode.png"), ShouldEqual, "qr code.png")
+		})
+	})
+}
+
+func TestServe(t *testing.T) {
+	floodDelay = time.Millisecond
+	defer func() { floodDelay = FloodDelay }()
+
+	Convey("Given a robot connected to a server", t, func() {
+		handler := gobot.Handlers{}.WithCommands(
+			&gobot.Command{
+				Grammar: "hello",
+				Action: func(c *gobot.Context) {
+					c.Respond("hello " + c.User + "\r\nQUIT :injected")
+				},
+			},
+			&gobot.Command{
+				Grammar: "deploy",
+				Role:    "deployer",
+				Action:  func(c *gobot.Context) { c.Respond("deployed") },
+			},
+		)
+		So(handler.OnLoad(), ShouldBeNil)
+
+		server, client := net.Pipe()
+		defer server.Close()
+		reader := bufio.NewReader(server)
+
+		expect := func() string {
+			server.SetReadDeadline(time.Now().Add(2 * time.Second))
+			line, err := reader.ReadString('\n')
+			So(err, ShouldBeNil)
+			return strings.TrimRight(line, "\r\n")
+		}
+		write := func(line string) {
+			server.SetWriteDeadline(time.Now().Add(2 * time.Second))
+			_, err := server.Write([]byte(line + "\r\n"))
+			So(err, ShouldBeNil)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- serve(ctx, client, "gobot", "", []string{"#ops", " "}, handler)
+		}()
+
+		Convey("Then it registers, answers pings, joins on welcome, and replies to messages", func() {
+			So(expect(), ShouldEqual, "CAP REQ :account-tag")
+			So(expect(), ShouldEqual, "NICK gobot")
+			So(expect(), ShouldEqual, "USER gobot 0 * :gobot")
+
+			write(":irc.example.com CAP * ACK :account-tag")
+			So(expect(), ShouldEqual, "CAP END")
+
+			write("PING :irc.example.com")
+			So(expect(), ShouldEqual, "PONG :irc.example.com")
+
+			write(":irc.example.com 001 gobot :Welcome")
+			So(expect(), ShouldEqual, "JOIN #ops")
+
+			write("@account=mattho :matt!m@example.com PRIVMSG #ops :gobot: hello")
+			So(expect(), ShouldEqual, "PRIVMSG #ops :hello mattho")
+			So(expect(), ShouldEqual, "PRIVMSG #ops :QUIT :injected")
+
+			write(":mattho!m@example.com PRIVMSG #ops :gobot: hello")
+			So(expect(), ShouldEqual, "PRIVMSG #ops :hello ~mattho")
+			So(expect(), ShouldEqual, "PRIVMSG #ops :QUIT :injected")
+
+			write(":mattho!m@example.com PRIVMSG #ops :gobot: deploy")
+			So(expect(), ShouldEqual, "PRIVMSG #ops :Sorry, `deploy` is restricted and I can't tell who you are.  Identify yourself and try again.")
+
+			cancel()
+			So(expect(), ShouldEqual, "QUIT :shutting down")
+
+			select {
+			case err := <-done:
+				So(err, ShouldBeNil)
+			case <-time.After(2 * time.Second):
+				So("serve did not return", ShouldBeEmpty)
+			}
+		})
+	})
+}
@@ -0,0 +1,596 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+)
+
+const (
+	// DefaultStateFile holds the sync token between restarts
+	DefaultStateFile = ".gobot-matrix-sync"
+
+	// SyncTimeout is how long the server may hold each sync request open waiting for events
+	SyncTimeout = 30 * time.Second
+
+	// RetryDelay is how long to wait after a failed sync before trying again
+	RetryDelay = 5 * time.Second
+
+	// SendTimeout limits how long each response may take to send
+	SendTimeout = 30 * time.Second
+)
+
+// Listen connects to the homeserver at GOBOT_MATRIX_URL using the access token in
+// GOBOT_MATRIX_TOKEN and dispatches messages addressed to name to the handler.  Room invites are
+// accepted automatically.  Direct chats, per the m.direct account data or is_direct on the invite,
+// are treated as private and need no name prefix.  The sync token is saved to GOBOT_MATRIX_STATE, defaulting to
+// DefaultStateFile, so restarts don't replay history.
+func Listen(ctx context.Context, name string, handler gobot.Handler) error {
+	homeserver := os.Getenv("GOBOT_MATRIX_URL")
+	if homeserver == "" {
+		return fmt.Errorf("ERROR - missing env variable, GOBOT_MATRIX_URL")
+	}
+	token := os.Getenv("GOBOT_MATRIX_TOKEN")
+	if token == "" {
+		return fmt.Errorf("ERROR - missing env variable, GOBOT_MATRIX_TOKEN")
+	}
+	state := os.Getenv("GOBOT_MATRIX_STATE")
+	if state == "" {
+		state = DefaultStateFile
+	}
+
+	return ListenWith(ctx, New(homeserver, token), name, state, handler)
+}
+
+// Listener returns the matrix listener for use with gobot.Bot
+func Listener(name string) gobot.Listener {
+	return gobot.NewListener("matrix", func(ctx context.Context, handler gobot.Handler) error {
+		return Listen(ctx, name, handler)
+	})
+}
+
+// ListenWith listens for messages using the client provided, persisting the sync token to state
+func ListenWith(ctx context.Context, client *Client, name, state string, handler gobot.Handler) error {
+	log.WithField("provider", "matrix").Debugf("starting matrix listener with name, %s", name)
+
+	// 1. find out who we are so we can ignore our own messages
+	userId, err := client.WhoAmI()
+	if err != nil {
+		return err
+	}
+
+	// 2. create a matcher for the name, also accepting the localpart of our user id e.g. @gobot:example.com
+	localpart := strings.TrimPrefix(strings.SplitN(userId, ":", 2)[0], "@")
+	pattern := fmt.Sprintf(`^\s*@?(?:%s|%s)[:,]?\s+(.*)$`, regexp.QuoteMeta(name), regexp.QuoteMeta(localpart))
+	matcher, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	// 3. learn which rooms are direct chats; not fatal, but direct chats will then need the name
+	direct := &directRooms{}
+	rooms, err := client.DirectRooms(ctx, userId)
+	if err != nil {
+		log.WithField("provider", "matrix").Warnf("unable to retrieve direct chats => %s", err.Error())
+	}
+	direct.set(rooms)
+
+	r := robot{
+		ctx:     ctx,
+		client:  client,
+		userId:  userId,
+		matcher: matcher,
+		handler: handler,
+		direct:  direct,
+	}
+
+	// 4. sync until we're told to stop
+	return r.syncLoop(state)
+}
+
+// -------------------------------------------------------
+
+// Client is a minimal client for the matrix client-server api
+type Client struct {
+	URL   string
+	Token string
+	http  *http.Client
+	txn   int64
+}
+
+func New(homeserver, token string) *Client {
+	return &Client{
+		URL:   strings.TrimSuffix(homeserver, "/"),
+		Token: token,
+		http:  &http.Client{Timeout: SyncTimeout + 30*time.Second},
+	}
+}
+
+// apiError is returned for non-2xx responses
+type apiError struct {
+	Method string
+	Path   string
+	Status int
+	Body   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("matrix %s %s failed with status %d => %s", e.Method, e.Path, e.Status, e.Body)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest(method, c.URL+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return &apiError{Method: method, Path: path, Status: resp.StatusCode, Body: string(data)}
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, method, path, "application/json", bytes.NewReader(data), out)
+}
+
+// WhoAmI returns the user id the access token belongs to
+func (c *Client) WhoAmI() (string, error) {
+	result := struct {
+		UserId string `json:"user_id"`
+	}{}
+	err := c.do(context.Background(), "GET", "/_matrix/client/v3/account/whoami", "", nil, &result)
+	return result.UserId, err
+}
+
+type Event struct {
+	Type     string                 `json:"type"`
+	Sender   string                 `json:"sender"`
+	EventId  string                 `json:"event_id"`
+	StateKey string                 `json:"state_key,omitempty"`
+	Content  map[string]interface{} `json:"content"`
+}
+
+type Room struct {
+	Timeline struct {
+		Events []Event `json:"events"`
+	} `json:"timeline"`
+}
+
+type InvitedRoom struct {
+	InviteState struct {
+		Events []Event `json:"events"`
+	} `json:"invite_state"`
+}
+
+type SyncResponse struct {
+	NextBatch   string `json:"next_batch"`
+	AccountData struct {
+		Events []Event `json:"events"`
+	} `json:"account_data"`
+	Rooms struct {
+		Join   map[string]Room        `json:"join"`
+		Invite map[string]InvitedRoom `json:"invite"`
+	} `json:"rooms"`
+}
+
+// Sync returns events since the token provided, waiting up to timeout for new events
+func (c *Client) Sync(ctx context.Context, since string, timeout time.Duration) (*SyncResponse, error) {
+	params := url.Values{}
+	params.Set("timeout", fmt.Sprintf("%d", timeout/time.Millisecond))
+	if since != "" {
+		params.Set("since", since)
+	}
+
+	result := &SyncResponse{}
+	err := c.do(ctx, "GET", "/_matrix/client/v3/sync?"+params.Encode(), "", nil, result)
+	return result, err
+}
+
+// Join accepts an invite to roomId
+func (c *Client) Join(ctx context.Context, roomId string) error {
+	return c.doJSON(ctx, "POST", "/_matrix/client/v3/join/"+url.PathEscape(roomId), map[string]string{}, nil)
+}
+
+// JoinedMembers returns the user ids of those joined to roomId
+func (c *Client) JoinedMembers(ctx context.Context, roomId string) ([]string, error) {
+	result := struct {
+		Joined map[string]interface{} `json:"joined"`
+	}{}
+	if err := c.do(ctx, "GET", "/_matrix/client/v3/rooms/"+url.PathEscape(roomId)+"/joined_members", "", nil, &result); err != nil {
+		return nil, err
+	}
+
+	members := []string{}
+	for userId := range result.Joined {
+		members = append(members, userId)
+	}
+	return members, nil
+}
+
+// DirectRooms returns the m.direct account data of userId; the direct chat room ids keyed by the
+// user each is with
+func (c *Client) DirectRooms(ctx context.Context, userId string) (map[string][]string, error) {
+	rooms := map[string][]string{}
+	err := c.do(ctx, "GET", directPath(userId), "", nil, &rooms)
+	if e, ok := err.(*apiError); ok && e.Status == http.StatusNotFound {
+		// no direct chats yet
+		return rooms, nil
+	}
+	return rooms, err
+}
+
+// SetDirectRooms replaces the m.direct account data of userId
+func (c *Client) SetDirectRooms(ctx context.Context, userId string, rooms map[string][]string) error {
+	return c.doJSON(ctx, "PUT", directPath(userId), rooms, nil)
+}
+
+func directPath(userId string) string {
+	return "/_matrix/client/v3/user/" + url.PathEscape(userId) + "/account_data/m.direct"
+}
+
+// Send sends a m.room.message event with the content provided to roomId
+func (c *Client) Send(ctx context.Context, roomId string, content map[string]interface{}) error {
+	txn := atomic.AddInt64(&c.txn, 1)
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/gobot-%d-%d", url.PathEscape(roomId), time.Now().UnixNano(), txn)
+	return c.doJSON(ctx, "PUT", path, content, nil)
+}
+
+// Upload stores content in the media repository, returning its mxc:// uri
+func (c *Client) Upload(ctx context.Context, filename, contentType string, content io.Reader) (string, error) {
+	result := struct {
+		ContentUri string `json:"content_uri"`
+	}{}
+	path := "/_matrix/media/v3/upload?filename=" + url.QueryEscape(filename)
+	err := c.do(ctx, "POST", path, contentType, content, &result)
+	return result.ContentUri, err
+}
+
+// -------------------------------------------------------
+
+type robot struct {
+	ctx     context.Context
+	client  *Client
+	userId  string
+	matcher *regexp.Regexp
+	handler gobot.Handler
+	direct  *directRooms
+}
+
+func (r robot) syncLoop(state string) error {
+	since := loadToken(state)
+	if since == "" {
+		// first run; skip existing history rather than replaying it
+		resp, err := r.client.Sync(r.ctx, "", 0)
+		if err != nil {
+			return err
+		}
+		r.onAccountData(resp.AccountData.Events)
+		since = resp.NextBatch
+		saveToken(state, since)
+	}
+
+	for {
+		resp, err := r.client.Sync(r.ctx, since, SyncTimeout)
+		if r.ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.WithField("provider", "matrix").Warnf("sync failed, retrying in %v => %s", RetryDelay, err.Error())
+			select {
+			case <-time.After(RetryDelay):
+				continue
+			case <-r.ctx.Done():
+				return nil
+			}
+		}
+
+		r.onAccountData(resp.AccountData.Events)
+
+		for roomId, room := range resp.Rooms.Invite {
+			r.join(roomId, room)
+		}
+
+		for roomId, room := range resp.Rooms.Join {
+			for _, event := range room.Timeline.Events {
+				r.onEvent(roomId, event)
+			}
+		}
+
+		since = resp.NextBatch
+		if err := saveToken(state, since); err != nil {
+			log.WithField("provider", "matrix").Warnf("unable to save sync token => %s", err.Error())
+		}
+	}
+}
+
+func (r robot) onAccountData(events []Event) {
+	for _, event := range events {
+		if event.Type == "m.direct" {
+			r.direct.set(parseDirect(event.Content))
+		}
+	}
+}
+
+// join accepts an invite.  Invites to direct chats are recorded in our m.direct account data, as
+// the spec asks of the invitee, so they're still known to be direct after a restart.
+func (r robot) join(roomId string, room InvitedRoom) {
+	log.WithField("provider", "matrix").Infof("joining room, %s", roomId)
+	if err := r.client.Join(r.ctx, roomId); err != nil {
+		log.WithField("provider", "matrix").Warnf("unable to join room, %s => %s", roomId, err.Error())
+		return
+	}
+
+	inviter, ok := r.directInviter(room)
+	if !ok {
+		return
+	}
+	if err := r.client.SetDirectRooms(r.ctx, r.userId, r.direct.add(inviter, roomId)); err != nil {
+		log.WithField("provider", "matrix").Warnf("unable to record direct chat, %s => %s", roomId, err.Error())
+	}
+}
+
+// directInviter returns who invited us if the invite is to a direct chat
+func (r robot) directInviter(room InvitedRoom) (string, bool) {
+	for _, event := range room.InviteState.Events {
+		if event.Type != "m.room.member" || event.StateKey != r.userId {
+			continue
+		}
+		if isDirect, _ := event.Content["is_direct"].(bool); isDirect {
+			return event.Sender, true
+		}
+	}
+	return "", false
+}
+
+func (r robot) onEvent(roomId string, event Event) {
+	if event.Type != "m.room.message" || event.Sender == r.userId {
+		return
+	}
+	if msgtype, _ := event.Content["msgtype"].(string); msgtype != "m.text" {
+		return
+	}
+	body, _ := event.Content["body"].(string)
+
+	log.WithField("provider", "matrix").Debugf("[RAW] => %s", body)
+
+	// direct chats are always addressed to us, with or without the name
+	direct := r.direct.is(roomId)
+	text := ""
+	if matches := r.matcher.FindStringSubmatch(body); len(matches) > 1 {
+		text = strings.TrimSpace(matches[1])
+	} else if direct {
+		text = strings.TrimSpace(body)
+	}
+
+	if text != "" {
+		log.WithField("provider", "matrix").Debugf("[IN]  => %s", text)
+
+		// handle each message on its own goroutine so a slow command doesn't hold up the sync loop
+		go func(sender string) {
+			private := direct && r.private(roomId, sender)
+			r.dispatch(roomId, r.newContext(roomId, sender, private, text))
+		}(event.Sender)
+
+	} else if answerer, ok := r.handler.(gobot.Answerer); ok {
+		// not addressed to us, but it may be the answer to a question we asked
+		answerer.Answer(r.newContext(roomId, event.Sender, false, strings.TrimSpace(body)))
+	}
+}
+
+// private returns true if the only members of roomId are us and sender.  Being a direct chat is
+// only a hint; anyone may mark a room direct, and others may have joined since.
+func (r robot) private(roomId, sender string) bool {
+	members, err := r.client.JoinedMembers(r.ctx, roomId)
+	if err != nil {
+		log.WithField("provider", "matrix").Warnf("unable to retrieve members of %s => %s", roomId, err.Error())
+		return false
+	}
+	return len(members) == 2 && contains(members, r.userId) && contains(members, sender)
+}
+
+func (r robot) newContext(roomId, sender string, private bool, text string) *gobot.Context {
+	return &gobot.Context{
+		Context: r.ctx,
+		User:    sender,
+		Channel: roomId,
+		Text:    text,
+		Private: private,
+		Sender: gobot.SenderFunc(func(response *gobot.Response) error {
+			return r.respond(roomId, response)
+		}),
+	}
+}
+
+func (r robot) dispatch(roomId string, ctx *gobot.Context) {
+	if response, ok := r.handler.OnMessage(ctx); ok {
+		if err := r.respond(roomId, response); err != nil {
+			log.WithField("provider", "matrix").Warnf("unable to respond to '%s' => %s", ctx.Text, err.Error())
+		}
+	}
+}
+
+// respond sends the response to roomId.  It doesn't use r.ctx, so the last words of work cut short
+// by shutdown are still sent while the listener is being stopped.
+func (r robot) respond(roomId string, response *gobot.Response) error {
+	ctx, cancel := context.WithTimeout(context.Background(), SendTimeout)
+	defer cancel()
+
+	if response.Text != "" {
+		log.WithField("provider", "matrix").Debugf("[OUT] => %s", response.Text)
+		err := r.client.Send(ctx, roomId, map[string]interface{}{
+			"msgtype": "m.text",
+			"body":    response.Text,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, a := range response.Attachments {
+		data, err := ioutil.ReadAll(a.Content)
+		if err != nil {
+			return err
+		}
+
+		uri, err := r.client.Upload(ctx, a.Filename, a.ContentType, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+
+		msgtype := "m.file"
+		if strings.HasPrefix(a.ContentType, "image/") {
+			msgtype = "m.image"
+		}
+		err = r.client.Send(ctx, roomId, map[string]interface{}{
+			"msgtype": msgtype,
+			"body":    a.Filename,
+			"url":     uri,
+			"info": map[string]interface{}{
+				"mimetype": a.ContentType,
+				"size":     len(data),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// -------------------------------------------------------
+
+// directRooms tracks which rooms are direct chats.  It's shared by the sync loop and the
+// goroutines handling each message.
+type directRooms struct {
+	mutex sync.Mutex
+	rooms map[string][]string
+}
+
+// set replaces the direct chats with the m.direct content provided
+func (d *directRooms) set(rooms map[string][]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.rooms = map[string][]string{}
+	for user, ids := range rooms {
+		d.rooms[user] = append([]string{}, ids...)
+	}
+}
+
+// add records roomId as a direct chat with user, returning the updated m.direct content
+func (d *directRooms) add(user, roomId string) map[string][]string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.rooms == nil {
+		d.rooms = map[string][]string{}
+	}
+	if !contains(d.rooms[user], roomId) {
+		d.rooms[user] = append(d.rooms[user], roomId)
+	}
+
+	rooms := map[string][]string{}
+	for user, ids := range d.rooms {
+		rooms[user] = append([]string{}, ids...)
+	}
+	return rooms
+}
+
+func (d *directRooms) is(roomId string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, ids := range d.rooms {
+		if contains(ids, roomId) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ids []string, roomId string) bool {
+	for _, id := range ids {
+		if id == roomId {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDirect converts the content of a m.direct event, user ids mapped to lists of room ids
+func parseDirect(content map[string]interface{}) map[string][]string {
+	rooms := map[string][]string{}
+	for user, v := range content {
+		ids, _ := v.([]interface{})
+		for _, id := range ids {
+			if roomId, ok := id.(string); ok {
+				rooms[user] = append(rooms[user], roomId)
+			}
+		}
+	}
+	return rooms
+}
+
+func loadToken(filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// saveToken writes the token atomically so a crash can't leave a partial token behind
+func saveToken(filename, token string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".matrix")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(token); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,257 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func message(sender, body string) Event {
+	return Event{
+		Type:    "m.room.message",
+		Sender:  sender,
+		Content: map[string]interface{}{"msgtype": "m.text", "body": body},
+	}
+}
+
+// fakeServer implements just enough of the client-server api to exercise the listener.  The
+// initial sync returns history that must not be replayed; the next returns an invite and new messages
+func fakeServer(sent chan map[string]interface{}, joined chan string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_matrix/client/v3/account/whoami", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"user_id": "@gobot:example.com"})
+	})
+	mux.HandleFunc("/_matrix/client/v3/sync", func(w http.ResponseWriter, req *http.Request) {
+		resp := SyncResponse{}
+		switch req.URL.Query().Get("since") {
+		case "":
+			resp.NextBatch = "s1"
+			resp.Rooms.Join = map[string]Room{}
+			room := Room{}
+			room.Timeline.Events = []Event{message("@alice:example.com", "gobot hello")}
+			resp.Rooms.Join["!room:example.com"] = room
+		case "s1":
+			resp.NextBatch = "s2"
+			resp.Rooms.Invite = map[string]InvitedRoom{"!new:example.com": {}}
+			resp.Rooms.Join = map[string]Room{}
+			room := Room{}
+			room.Timeline.Events = []Event{
+				message("@bob:example.com", "just chatting"),
+				message("@gobot:example.com", "gobot hello"),
+				message("@bob:example.com", "gobot: hello"),
+			}
+			resp.Rooms.Join["!room:example.com"] = room
+		default:
+			// nothing new; hold the request open until the client goes away
+			<-req.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/_matrix/client/v3/join/", func(w http.ResponseWriter, req *http.Request) {
+		joined <- strings.TrimPrefix(req.URL.Path, "/_matrix/client/v3/join/")
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("/_matrix/client/v3/rooms/", func(w http.ResponseWriter, req *http.Request) {
+		content := map[string]interface{}{}
+		json.NewDecoder(req.Body).Decode(&content)
+		sent <- content
+		w.Write([]byte(`{"event_id":"$1"}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestListen(t *testing.T) {
+	Convey("Given a matrix homeserver", t, func() {
+		sent := make(chan map[string]interface{}, 10)
+		joined := make(chan string, 10)
+		server := fakeServer(sent, joined)
+		defer server.Close()
+
+		dir, err := ioutil.TempDir("", "matrix")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		state := filepath.Join(dir, "sync")
+
+		handlers := gobot.Handlers{}.WithCommands(&gobot.Command{
+			Grammar: "hello",
+			Action:  func(c *gobot.Context) { c.Respond("world, " + c.User) },
+		})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go ListenWith(ctx, New(server.URL, "token"), "gobot", state, handlers)
+
+		Convey("Then I expect invites to be accepted", func() {
+			select {
+			case room := <-joined:
+				So(room, ShouldEqual, "!new:example.com")
+			case <-time.After(5 * time.Second):
+				So("timed out waiting for a join", ShouldBeEmpty)
+			}
+		})
+
+		Convey("Then I expect only new messages addressed to the bot to be answered", func() {
+			select {
+			case content := <-sent:
+				So(content["msgtype"], ShouldEqual, "m.text")
+				So(content["body"], ShouldEqual, "world, @bob:example.com")
+			case <-time.After(5 * time.Second):
+				So("timed out waiting for a reply", ShouldBeEmpty)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			So(len(sent), ShouldEqual, 0)
+			So(loadToken(state), ShouldEqual, "s2")
+		})
+	})
+}
+
+func TestDirect(t *testing.T) {
+	Convey("Given a homeserver with a direct chat and an invite to another", t, func() {
+		sent := make(chan string, 10)
+		direct := make(chan map[string][]string, 1)
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/_matrix/client/v3/account/whoami", func(w http.ResponseWriter, req *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{"user_id": "@gobot:example.com"})
+		})
+		mux.HandleFunc("/_matrix/client/v3/user/@gobot:example.com/account_data/m.direct", func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == "PUT" {
+				rooms := map[string][]string{}
+				json.NewDecoder(req.Body).Decode(&rooms)
+				direct <- rooms
+			} else {
+				json.NewEncoder(w).Encode(map[string][]string{
+					"@alice:example.com": {"!alice:example.com"},
+					"@dave:example.com":  {"!dave:example.com"},
+				})
+			}
+		})
+		mux.HandleFunc("/_matrix/client/v3/sync", func(w http.ResponseWriter, req *http.Request) {
+			resp := SyncResponse{}
+			resp.Rooms.Join = map[string]Room{}
+			switch req.URL.Query().Get("since") {
+			case "":
+				resp.NextBatch = "s1"
+			case "s1":
+				resp.NextBatch = "s2"
+				invite := InvitedRoom{}
+				invite.InviteState.Events = []Event{{
+					Type:     "m.room.member",
+					Sender:   "@carol:example.com",
+					StateKey: "@gobot:example.com",
+					Content:  map[string]interface{}{"membership": "invite", "is_direct": true},
+				}}
+				resp.Rooms.Invite = map[string]InvitedRoom{"!carol:example.com": invite}
+				for roomId, sender := range map[string]string{"!alice:example.com": "@alice:example.com", "!room:example.com": "@bob:example.com"} {
+					room := Room{}
+					room.Timeline.Events = []Event{message(sender, "hello")}
+					resp.Rooms.Join[roomId] = room
+				}
+				room := Room{}
+				room.Timeline.Events = []Event{message("@dave:example.com", "gobot: hello")}
+				resp.Rooms.Join["!dave:example.com"] = room
+			case "s2":
+				resp.NextBatch = "s3"
+				room := Room{}
+				room.Timeline.Events = []Event{message("@carol:example.com", "hello")}
+				resp.Rooms.Join["!carol:example.com"] = room
+			default:
+				<-req.Context().Done()
+				return
+			}
+			json.NewEncoder(w).Encode(resp)
+		})
+		mux.HandleFunc("/_matrix/client/v3/join/", func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("{}"))
+		})
+		// dave's direct chat has been joined by eve too, so it's no longer private
+		members := map[string][]string{
+			"!alice:example.com": {"@alice:example.com", "@gobot:example.com"},
+			"!carol:example.com": {"@carol:example.com", "@gobot:example.com"},
+			"!dave:example.com":  {"@dave:example.com", "@gobot:example.com", "@eve:example.com"},
+		}
+		mux.HandleFunc("/_matrix/client/v3/rooms/", func(w http.ResponseWriter, req *http.Request) {
+			if strings.HasSuffix(req.URL.Path, "/joined_members") {
+				roomId := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/_matrix/client/v3/rooms/"), "/joined_members")
+				joined := map[string]interface{}{}
+				for _, userId := range members[roomId] {
+					joined[userId] = map[string]interface{}{}
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"joined": joined})
+				return
+			}
+
+			content := map[string]interface{}{}
+			json.NewDecoder(req.Body).Decode(&content)
+			sent <- content["body"].(string)
+			w.Write([]byte(`{"event_id":"$1"}`))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		dir, err := ioutil.TempDir("", "matrix")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		handlers := gobot.Handlers{}.WithCommands(&gobot.Command{
+			Grammar: "hello",
+			Action: func(c *gobot.Context) {
+				if c.Private {
+					c.Respond("privately, " + c.User)
+				} else {
+					c.Respond("publicly, " + c.User)
+				}
+			},
+		})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go ListenWith(ctx, New(server.URL, "token"), "gobot", filepath.Join(dir, "sync"), handlers)
+
+		Convey("Then I expect the direct invite to be recorded in m.direct", func() {
+			select {
+			case rooms := <-direct:
+				So(rooms, ShouldResemble, map[string][]string{
+					"@alice:example.com": {"!alice:example.com"},
+					"@carol:example.com": {"!carol:example.com"},
+					"@dave:example.com":  {"!dave:example.com"},
+				})
+			case <-time.After(5 * time.Second):
+				So("timed out waiting for m.direct", ShouldBeEmpty)
+			}
+		})
+
+		Convey("Then I expect un-prefixed messages in direct chats only to be answered, privately while no one else has joined", func() {
+			replies := []string{}
+			for len(replies) < 3 {
+				select {
+				case reply := <-sent:
+					replies = append(replies, reply)
+				case <-time.After(5 * time.Second):
+					So("timed out waiting for replies", ShouldBeEmpty)
+					return
+				}
+			}
+			So(replies, ShouldContain, "privately, @alice:example.com")
+			So(replies, ShouldContain, "privately, @carol:example.com")
+			So(replies, ShouldContain, "publicly, @dave:example.com")
+
+			time.Sleep(100 * time.Millisecond)
+			So(len(sent), ShouldEqual, 0)
+		})
+	})
+}
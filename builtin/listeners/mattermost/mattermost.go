@@ -0,0 +1,318 @@
+package mattermost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
+	"github.com/savaki/gobot"
+)
+
+// Listen connects to the mattermost server at GOBOT_MATTERMOST_URL using the personal access or
+// bot token in GOBOT_MATTERMOST_TOKEN and dispatches messages addressed to name to the handler.
+func Listen(ctx context.Context, name string, handler gobot.Handler) error {
+	codebase := os.Getenv("GOBOT_MATTERMOST_URL")
+	if codebase == "" {
+		return fmt.Errorf("ERROR - missing env variable, GOBOT_MATTERMOST_URL")
+	}
+	token := os.Getenv("GOBOT_MATTERMOST_TOKEN")
+	if token == "" {
+		return fmt.Errorf("ERROR - missing env variable, GOBOT_MATTERMOST_TOKEN")
+	}
+
+	return ListenWith(ctx, New(codebase, token), name, handler)
+}
+
+// Listener returns the mattermost listener for use with gobot.Bot
+func Listener(name string) gobot.Listener {
+	return gobot.NewListener("mattermost", func(ctx context.Context, handler gobot.Handler) error {
+		return Listen(ctx, name, handler)
+	})
+}
+
+// ListenWith listens for messages using the client provided
+func ListenWith(ctx context.Context, client *Client, name string, handler gobot.Handler) error {
+	log.WithField("provider", "mattermost").Debugf("starting mattermost listener with name, %s", name)
+
+	// 1. find out who we are so we can ignore our own posts
+	me, err := client.Me()
+	if err != nil {
+		return err
+	}
+
+	// 2. create a matcher for the name
+	pattern := fmt.Sprintf(`\s*%s\s+(.*)$`, regexp.QuoteMeta(name))
+	matcher, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	r := robot{
+		ctx:     ctx,
+		client:  client,
+		me:      me,
+		matcher: matcher,
+		handler: handler,
+	}
+
+	// 3. listen to the event stream
+	return client.Listen(ctx, r.onEvent)
+}
+
+// -------------------------------------------------------
+
+// Client is a minimal client for the mattermost v4 api
+type Client struct {
+	URL   string
+	Token string
+	http  *http.Client
+}
+
+func New(codebase, token string) *Client {
+	return &Client{
+		URL:   strings.TrimSuffix(codebase, "/"),
+		Token: token,
+		http:  http.DefaultClient,
+	}
+}
+
+type User struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type Post struct {
+	Id        string   `json:"id,omitempty"`
+	UserId    string   `json:"user_id,omitempty"`
+	ChannelId string   `json:"channel_id"`
+	RootId    string   `json:"root_id,omitempty"`
+	Message   string   `json:"message"`
+	FileIds   []string `json:"file_ids,omitempty"`
+}
+
+// Event is a websocket event.  Data holds values of any json type; set_online, for example, is a
+// bool, so use String to read the string valued fields.
+type Event struct {
+	Event string                 `json:"event"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// String returns the named field of Data or "" if it's missing or not a string
+func (e Event) String(key string) string {
+	v, _ := e.Data[key].(string)
+	return v
+}
+
+func (c *Client) do(method, path, contentType string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest(method, c.URL+"/api/v4"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("mattermost %s %s failed with status %d => %s", method, path, resp.StatusCode, string(data))
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Me returns the user the token belongs to
+func (c *Client) Me() (*User, error) {
+	user := &User{}
+	err := c.do("GET", "/users/me", "", nil, user)
+	return user, err
+}
+
+// CreatePost posts a message to a channel
+func (c *Client) CreatePost(post Post) error {
+	data, err := json.Marshal(post)
+	if err != nil {
+		return err
+	}
+	return c.do("POST", "/posts", "application/json", bytes.NewReader(data), nil)
+}
+
+// UploadFile uploads content to a channel, returning the file id to attach to a post
+func (c *Client) UploadFile(channelId, filename string, content io.Reader) (string, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	w.WriteField("channel_id", channelId)
+	part, err := w.CreateFormFile("files", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	result := struct {
+		FileInfos []struct {
+			Id string `json:"id"`
+		} `json:"file_infos"`
+	}{}
+	if err := c.do("POST", "/files", w.FormDataContentType(), buf, &result); err != nil {
+		return "", err
+	}
+	if len(result.FileInfos) == 0 {
+		return "", fmt.Errorf("mattermost returned no file info for %s", filename)
+	}
+	return result.FileInfos[0].Id, nil
+}
+
+// Listen connects to the websocket event stream and calls fn for each event until ctx is cancelled
+func (c *Client) Listen(ctx context.Context, fn func(Event)) error {
+	u, err := url.Parse(c.URL + "/api/v4/websocket")
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.WriteJSON(map[string]interface{}{
+		"seq":    1,
+		"action": "authentication_challenge",
+		"data":   map[string]string{"token": c.Token},
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		event := Event{}
+		if err := conn.ReadJSON(&event); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if event.Event != "" {
+			fn(event)
+		}
+	}
+}
+
+// -------------------------------------------------------
+
+type robot struct {
+	ctx     context.Context
+	client  *Client
+	me      *User
+	matcher *regexp.Regexp
+	handler gobot.Handler
+}
+
+func (r robot) onEvent(event Event) {
+	if event.Event != "posted" {
+		return
+	}
+
+	post := Post{}
+	if err := json.Unmarshal([]byte(event.String("post")), &post); err != nil {
+		log.WithField("provider", "mattermost").Warnf("unable to parse post => %s", err.Error())
+		return
+	}
+	if post.UserId == r.me.Id {
+		return
+	}
+	private := event.String("channel_type") == "D"
+
+	log.WithField("provider", "mattermost").Debugf("[RAW] => %s", post.Message)
+	if matches := r.matcher.FindStringSubmatch(post.Message); len(matches) > 1 {
+		text := strings.TrimSpace(matches[1])
+
+		log.WithField("provider", "mattermost").Debugf("[IN]  => %s", text)
+
+		// handle each message on its own goroutine so a slow command doesn't hold up the event loop
+		go r.dispatch(post, r.newContext(post, private, text))
+
+	} else if answerer, ok := r.handler.(gobot.Answerer); ok {
+		// not addressed to us, but it may be the answer to a question we asked
+		answerer.Answer(r.newContext(post, private, strings.TrimSpace(post.Message)))
+	}
+}
+
+func (r robot) newContext(post Post, private bool, text string) *gobot.Context {
+	return &gobot.Context{
+		Context: r.ctx,
+		User:    post.UserId,
+		Channel: post.ChannelId,
+		Text:    text,
+		Private: private,
+		Sender: gobot.SenderFunc(func(response *gobot.Response) error {
+			return r.respond(post, response)
+		}),
+	}
+}
+
+func (r robot) dispatch(post Post, ctx *gobot.Context) {
+	if response, ok := r.handler.OnMessage(ctx); ok {
+		if err := r.respond(post, response); err != nil {
+			log.WithField("provider", "mattermost").Warnf("unable to respond to '%s' => %s", ctx.Text, err.Error())
+		}
+	}
+}
+
+func (r robot) respond(post Post, response *gobot.Response) error {
+	// upload attachments first so they can be included with the text
+	fileIds := []string{}
+	for _, a := range response.Attachments {
+		id, err := r.client.UploadFile(post.ChannelId, a.Filename, a.Content)
+		if err != nil {
+			return err
+		}
+		fileIds = append(fileIds, id)
+	}
+
+	if response.Text == "" && len(fileIds) == 0 {
+		return nil
+	}
+
+	log.WithField("provider", "mattermost").Debugf("[OUT] => %s", response.Text)
+	return r.client.CreatePost(Post{
+		ChannelId: post.ChannelId,
+		Message:   response.Text,
+		FileIds:   fileIds,
+	})
+}
@@ -0,0 +1,149 @@
+package mattermost
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeServer implements just enough of the mattermost api to exercise the listener
+func fakeServer(messages []string, posts chan Post) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users/me", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(User{Id: "bot", Username: "gobot"})
+	})
+	mux.HandleFunc("/api/v4/posts", func(w http.ResponseWriter, req *http.Request) {
+		post := Post{}
+		json.NewDecoder(req.Body).Decode(&post)
+		posts <- post
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/api/v4/websocket", func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		challenge := map[string]interface{}{}
+		conn.ReadJSON(&challenge)
+
+		for _, message := range messages {
+			post, _ := json.Marshal(Post{UserId: "matt", ChannelId: "town-square", Message: message})
+			conn.WriteJSON(Event{Event: "posted", Data: map[string]interface{}{"post": string(post), "set_online": true}})
+		}
+
+		// hold the connection open until the client goes away
+		conn.ReadMessage()
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestListen(t *testing.T) {
+	Convey("Given a mattermost server", t, func() {
+		posts := make(chan Post, 10)
+		server := fakeServer([]string{"just chatting", "gobot hello"}, posts)
+		defer server.Close()
+
+		handlers := gobot.Handlers{}.WithCommands(&gobot.Command{
+			Grammar: "hello",
+			Action:  func(c *gobot.Context) { c.Respond("world, " + c.User) },
+		})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go ListenWith(ctx, New(server.URL, "token"), "gobot", handlers)
+
+		Convey("Then I expect only messages addressed to the bot to be answered", func() {
+			select {
+			case post := <-posts:
+				So(post.ChannelId, ShouldEqual, "town-square")
+				So(post.Message, ShouldEqual, "world, matt")
+			case <-time.After(5 * time.Second):
+				So("timed out waiting for a post", ShouldBeEmpty)
+			}
+			So(len(posts), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestEvent(t *testing.T) {
+	Convey("Given a posted event as sent by the server", t, func() {
+		payload := `{
+			"event": "posted",
+			"data": {
+				"channel_display_name": "@matt",
+				"channel_name": "bot__matt",
+				"channel_type": "D",
+				"mentions": "[\"bot\"]",
+				"post": "{\"id\":\"p1\",\"user_id\":\"matt\",\"channel_id\":\"dm\",\"message\":\"gobot hello\"}",
+				"sender_name": "@matt",
+				"set_online": true,
+				"team_id": ""
+			},
+			"broadcast": {"channel_id": "dm", "omit_users": null, "team_id": "", "user_id": ""},
+			"seq": 4
+		}`
+
+		event := Event{}
+		err := json.Unmarshal([]byte(payload), &event)
+
+		Convey("Then I expect non-string fields not to break parsing", func() {
+			So(err, ShouldBeNil)
+			So(event.Event, ShouldEqual, "posted")
+			So(event.String("channel_type"), ShouldEqual, "D")
+			So(event.String("set_online"), ShouldEqual, "")
+			So(event.String("missing"), ShouldEqual, "")
+		})
+
+		Convey("Then I expect the post to be dispatched as a private message", func() {
+			received := make(chan *gobot.Context, 1)
+			handlers := gobot.Handlers{}.WithCommands(&gobot.Command{
+				Grammar: "hello",
+				Action:  func(c *gobot.Context) { received <- c },
+			})
+			So(handlers.OnLoad(), ShouldBeNil)
+
+			r := robot{
+				ctx:     context.Background(),
+				client:  New("http://localhost", "token"),
+				me:      &User{Id: "bot", Username: "gobot"},
+				matcher: regexp.MustCompile(`^\s*gobot[:,]?\s+(.*)$`),
+				handler: handlers,
+			}
+			r.onEvent(event)
+
+			select {
+			case c := <-received:
+				So(c.User, ShouldEqual, "matt")
+				So(c.Channel, ShouldEqual, "dm")
+				So(c.Private, ShouldBeTrue)
+			case <-time.After(5 * time.Second):
+				So("timed out waiting for the command", ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("Given events whose data isn't all strings", t, func() {
+		payloads := []string{
+			`{"event": "hello", "data": {"connection_id": "abc", "server_version": "9.5.0"}, "seq": 0}`,
+			`{"event": "status_change", "data": {"status": "online", "user_id": "matt", "manual": false}, "seq": 1}`,
+			`{"status": "OK", "seq_reply": 1}`,
+		}
+
+		Convey("Then I expect each to parse", func() {
+			for _, payload := range payloads {
+				So(json.Unmarshal([]byte(payload), &Event{}), ShouldBeNil)
+			}
+		})
+	})
+}
@@ -0,0 +1,144 @@
+package slackbot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/savaki/gobot"
+)
+
+const (
+	// MaxBlocks is the most blocks slack accepts in a single message.  Longer responses are sent
+	// as plain text.
+	MaxBlocks = 50
+
+	// MaxFields is the most fields slack accepts in a single section
+	MaxFields = 10
+)
+
+// emoji shows each status in slack
+var emoji = map[gobot.Status]string{
+	gobot.StatusGood:    ":large_green_circle:",
+	gobot.StatusWarning: ":large_yellow_circle:",
+	gobot.StatusDanger:  ":red_circle:",
+}
+
+// styles maps each status onto the closest slack button style
+var styles = map[gobot.Status]string{
+	gobot.StatusGood:   "primary",
+	gobot.StatusDanger: "danger",
+}
+
+// actionId makes the action unique within its row, as slack requires
+func actionId(action string, index int) string {
+	return fmt.Sprintf("%s#%d", action, index)
+}
+
+// actionOf returns the action from an action id created by actionId
+func actionOf(actionId string) string {
+	if i := strings.LastIndex(actionId, "#"); i >= 0 {
+		return actionId[0:i]
+	}
+	return actionId
+}
+
+func mrkdwn(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "mrkdwn", "text": text}
+}
+
+func plainText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": text}
+}
+
+func withEmoji(status gobot.Status, text string) string {
+	if e, ok := emoji[status]; ok {
+		return e + " " + text
+	}
+	return text
+}
+
+// renderBlocks converts blocks into slack block kit json.  It returns nil if the blocks don't fit
+// in a single message.
+func renderBlocks(blocks []gobot.Block) []interface{} {
+	rendered := []interface{}{}
+
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case gobot.Section:
+			rendered = append(rendered, renderSection(b)...)
+
+		case gobot.Code:
+			rendered = append(rendered, map[string]interface{}{
+				"type": "section",
+				"text": mrkdwn("```" + b.Text + "```"),
+			})
+
+		case gobot.Divider:
+			rendered = append(rendered, map[string]interface{}{"type": "divider"})
+
+		case gobot.Buttons:
+			elements := []interface{}{}
+			for i, button := range b {
+				element := map[string]interface{}{
+					"type":      "button",
+					"text":      plainText(button.Text),
+					"action_id": actionId(button.Action, i),
+				}
+				if button.URL != "" {
+					element["url"] = button.URL
+				}
+				if button.Value != "" {
+					element["value"] = button.Value
+				}
+				if style, ok := styles[button.Style]; ok {
+					element["style"] = style
+				}
+				elements = append(elements, element)
+			}
+			rendered = append(rendered, map[string]interface{}{
+				"type":     "actions",
+				"elements": elements,
+			})
+
+		default:
+			// a block we don't know how to render natively
+			if text := block.PlainText(); text != "" {
+				rendered = append(rendered, map[string]interface{}{
+					"type": "section",
+					"text": mrkdwn(text),
+				})
+			}
+		}
+	}
+
+	if len(rendered) > MaxBlocks {
+		return nil
+	}
+	return rendered
+}
+
+// renderSection renders a section, continuing into further sections if it has more fields than
+// slack allows in one
+func renderSection(s gobot.Section) []interface{} {
+	section := map[string]interface{}{"type": "section"}
+	if s.Text != "" {
+		section["text"] = mrkdwn(withEmoji(s.Status, s.Text))
+	}
+	sections := []interface{}{section}
+
+	for i := 0; i < len(s.Fields); i += MaxFields {
+		if i > 0 {
+			section = map[string]interface{}{"type": "section"}
+			sections = append(sections, section)
+		}
+
+		fields := []interface{}{}
+		for j := i; j < len(s.Fields) && j < i+MaxFields; j++ {
+			f := s.Fields[j]
+			fields = append(fields, mrkdwn("*"+f.Name+"*\n"+withEmoji(f.Status, f.Value)))
+		}
+		section["fields"] = fields
+	}
+
+	return sections
+}
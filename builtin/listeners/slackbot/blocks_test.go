@@ -0,0 +1,69 @@
+package slackbot
+
+import (
+	"testing"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenderBlocks(t *testing.T) {
+	Convey("Given a rich response", t, func() {
+		blocks := []gobot.Block{
+			gobot.Section{Text: "Failed builds:"},
+			gobot.Section{Text: "api :: build", Status: gobot.StatusDanger},
+			gobot.Divider{},
+			gobot.Code{Text: "exit 1"},
+			gobot.Buttons{{Text: "Open", URL: "https://go.example.com", Style: gobot.StatusGood}},
+		}
+
+		Convey("Then I expect each block to be rendered as block kit", func() {
+			rendered := renderBlocks(blocks)
+			So(len(rendered), ShouldEqual, 5)
+			So(rendered[1], ShouldResemble, map[string]interface{}{
+				"type": "section",
+				"text": mrkdwn(":red_circle: api :: build"),
+			})
+			So(rendered[2], ShouldResemble, map[string]interface{}{"type": "divider"})
+			So(rendered[3], ShouldResemble, map[string]interface{}{
+				"type": "section",
+				"text": mrkdwn("```exit 1```"),
+			})
+			So(rendered[4], ShouldResemble, map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{map[string]interface{}{
+					"type":      "button",
+					"text":      plainText("Open"),
+					"action_id": "#0",
+					"url":       "https://go.example.com",
+					"style":     "primary",
+				}},
+			})
+		})
+	})
+
+	Convey("Given a section with more fields than slack allows", t, func() {
+		section := gobot.Section{Text: "stages"}
+		for i := 0; i < MaxFields+1; i++ {
+			section.Fields = append(section.Fields, gobot.Field{Name: "stage", Value: "Passed", Status: gobot.StatusGood})
+		}
+
+		Convey("Then I expect it to be split across sections", func() {
+			rendered := renderBlocks([]gobot.Block{section})
+			So(len(rendered), ShouldEqual, 2)
+			So(len(rendered[0].(map[string]interface{})["fields"].([]interface{})), ShouldEqual, MaxFields)
+			So(len(rendered[1].(map[string]interface{})["fields"].([]interface{})), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Given more blocks than fit in one message", t, func() {
+		blocks := []gobot.Block{}
+		for i := 0; i < MaxBlocks+1; i++ {
+			blocks = append(blocks, gobot.Divider{})
+		}
+
+		Convey("Then I expect to fall back to text", func() {
+			So(renderBlocks(blocks), ShouldBeNil)
+		})
+	})
+}
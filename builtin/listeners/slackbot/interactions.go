@@ -0,0 +1,182 @@
+package slackbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+	"github.com/savaki/slack"
+)
+
+const (
+	DefaultInteractionsAddr = ":8090"
+
+	// MaxClockSkew is how old a signed request from slack may be before it's rejected as a replay
+	MaxClockSkew = 5 * time.Minute
+
+	// MaxInteractionSize limits the size of interaction payloads
+	MaxInteractionSize = 1024 * 1024
+)
+
+// interaction is the subset of the slack block_actions payload we use
+type interaction struct {
+	Type string `json:"type"`
+	User struct {
+		Id string `json:"id"`
+	} `json:"user"`
+	Channel struct {
+		Id string `json:"id"`
+	} `json:"channel"`
+	Message struct {
+		Ts       string `json:"ts"`
+		ThreadTs string `json:"thread_ts"`
+	} `json:"message"`
+	Actions []struct {
+		ActionId string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// interactions receives button presses from slack, verifying each request was signed with the app's
+// signing secret
+type interactions struct {
+	robot  robot
+	secret string
+	now    func() time.Time
+}
+
+// serveInteractions listens for button presses on addr until the robot's context is done
+func (r robot) serveInteractions(addr, secret string) {
+	log.WithField("provider", "slackbot").Debugf("listening for interactions on %s", addr)
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: &interactions{robot: r, secret: secret, now: time.Now},
+	}
+
+	go func() {
+		<-r.ctx.Done()
+
+		timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(timeout)
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.WithField("provider", "slackbot").Errorf("interactions endpoint failed => %s", err.Error())
+	}
+}
+
+func (i *interactions) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, MaxInteractionSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := verify(i.secret, req.Header, body, i.now()); err != nil {
+		log.WithField("provider", "slackbot").Warnf("rejected interaction => %s", err.Error())
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload := interaction{}
+	if err := json.Unmarshal([]byte(values.Get("payload")), &payload); err != nil {
+		http.Error(w, fmt.Sprintf("unable to parse payload => %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// slack expects an acknowledgement within 3 seconds, so the work happens in the background
+	w.WriteHeader(http.StatusOK)
+
+	if payload.Type != "block_actions" {
+		return
+	}
+	for _, a := range payload.Actions {
+		event := slack.MessageEvent{
+			Channel:  payload.Channel.Id,
+			User:     payload.User.Id,
+			Text:     a.Value,
+			Ts:       payload.Message.Ts,
+			ThreadTs: payload.Message.ThreadTs,
+		}
+		ctx := i.robot.newContext(event, a.Value)
+		ctx.Action = actionOf(a.ActionId)
+
+		if ctx.Action == "" && ctx.Text == "" {
+			// a link button; slack opens the url itself
+			continue
+		}
+
+		log.WithField("provider", "slackbot").Debugf("[BTN] => %s %s", ctx.Action, ctx.Text)
+		go i.robot.press(event, ctx)
+	}
+}
+
+// press runs the button's callback, or its value as a command, replacing the original message
+// if the response asks to
+func (r robot) press(event slack.MessageEvent, ctx *gobot.Context) {
+	response, ok := r.handler.OnMessage(ctx)
+	if !ok {
+		return
+	}
+
+	var err error
+	if response.Replace {
+		err = r.web.updateMessage(message{
+			Channel: event.Channel,
+			Ts:      event.Ts,
+			Text:    response.Text,
+			Blocks:  renderBlocks(response.Blocks),
+		})
+	} else {
+		err = r.respond(event, ctx.Thread, response)
+	}
+	if err != nil {
+		log.WithField("provider", "slackbot").Warnf("unable to respond to button, '%s' => %s", ctx.Action, err.Error())
+	}
+}
+
+// verify checks the request was signed by slack using the signing secret.  See
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verify(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid request timestamp")
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return fmt.Errorf("request timestamp is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("invalid request signature")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package slackbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeWeb records the slack web api calls made by the robot
+func fakeWeb(calls chan string, messages chan message) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m := message{}
+		json.NewDecoder(req.Body).Decode(&m)
+		calls <- strings.TrimPrefix(req.URL.Path, "/")
+		messages <- m
+		w.Write([]byte(`{"ok":true}`))
+	}))
+}
+
+func sign(req *http.Request, secret, body string, at time.Time) {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func press(action, value string) string {
+	payload := fmt.Sprintf(`{
+		"type": "block_actions",
+		"user": {"id": "U123"},
+		"channel": {"id": "C123"},
+		"message": {"ts": "1.0"},
+		"actions": [{"action_id": %q, "value": %q}]
+	}`, action, value)
+	return url.Values{"payload": {payload}}.Encode()
+}
+
+func TestInteractions(t *testing.T) {
+	Convey("Given a robot with a callback and a command", t, func() {
+		calls := make(chan string, 10)
+		messages := make(chan message, 10)
+		server := fakeWeb(calls, messages)
+		defer server.Close()
+
+		handlers := gobot.Handlers{}.
+			WithCallbacks(&gobot.Callback{
+				Name: "approve",
+				Run: func(c *gobot.Context) {
+					c.Respond(c.Text + " approved by " + c.User).Replace = true
+				},
+			}).
+			WithCommands(&gobot.Command{
+				Grammar: "go build <pipeline>",
+				Action:  func(c *gobot.Context) { c.Respond("scheduled " + c.String("pipeline") + " for " + c.User) },
+			})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		web := newWeb("token")
+		web.url = server.URL + "/"
+		r := robot{ctx: context.Background(), web: web, handler: handlers}
+
+		now := time.Now()
+		handler := &interactions{robot: r, secret: "secret", now: func() time.Time { return now }}
+
+		post := func(body string, at time.Time) int {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			sign(req, "secret", body, at)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		Convey("When a callback button is pressed", func() {
+			So(post(press(actionId("approve", 0), "build"), now), ShouldEqual, http.StatusOK)
+
+			Convey("Then I expect the original message to be replaced", func() {
+				So(<-calls, ShouldEqual, "chat.update")
+				m := <-messages
+				So(m.Ts, ShouldEqual, "1.0")
+				So(m.Text, ShouldEqual, "build approved by U123")
+			})
+		})
+
+		Convey("When a command button is pressed", func() {
+			So(post(press(actionId("", 0), "go build api"), now), ShouldEqual, http.StatusOK)
+
+			Convey("Then I expect the command to run as the user who pressed it", func() {
+				So(<-calls, ShouldEqual, "chat.postMessage")
+				So((<-messages).Text, ShouldEqual, "scheduled api for U123")
+			})
+		})
+
+		Convey("When the signature is invalid", func() {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(press("approve#0", "build")))
+			sign(req, "wrong", press("approve#0", "build"), now)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			Convey("Then I expect the request to be rejected", func() {
+				So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Convey("When the request is stale", func() {
+			code := post(press("approve#0", "build"), now.Add(-MaxClockSkew-time.Minute))
+
+			Convey("Then I expect the request to be rejected", func() {
+				So(code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+	})
+}
@@ -1,7 +1,7 @@
 package slackbot
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
 	"regexp"
@@ -17,7 +17,14 @@ const (
 	DefaultName = "gobot"
 )
 
-func Listen(name string, handler gobot.Handler) error {
+// Listen connects to slack and dispatches messages addressed to name to the handler.  Commands
+// are run with ctx so that they may be cancelled when the bot shuts down.  GOBOT_SLACK_THREADS
+// optionally configures replies in threads per channel; see ParseThreads.
+//
+// Interactive buttons require the app's signing secret in GOBOT_SLACK_SIGNING_SECRET.  Slack
+// interactions are then received on GOBOT_SLACK_INTERACTIONS_ADDR, which defaults to
+// DefaultInteractionsAddr.
+func Listen(ctx context.Context, name string, handler gobot.Handler) error {
 	log.WithField("provider", "slackbot").Debugf("starting slack listener with name, %s", name)
 
 	// 1. retrieve the api
@@ -27,50 +34,142 @@ func Listen(name string, handler gobot.Handler) error {
 	}
 	api := slack.New(token)
 
-	// 2. create a matcher for the name
-	pattern := fmt.Sprintf(`\s*%s\s+(.*)$`, name)
-	matcher, err := regexp.Compile(pattern)
+	threads, err := ParseThreads(os.Getenv("GOBOT_SLACK_THREADS"))
+	if err != nil {
+		return err
+	}
+
+	// 2. create a matcher for the name or an @mention of the bot
+	web := newWeb(token)
+	userId, err := web.authTest()
+	if err != nil {
+		return err
+	}
+	matcher, err := newMatcher(name, userId)
 	if err != nil {
 		return err
 	}
 
 	r := robot{
+		ctx:     ctx,
 		api:     api,
+		web:     web,
 		name:    name,
+		userId:  userId,
+		threads: threads,
 		matcher: matcher,
 		handler: handler,
 	}
 
-	// 3. pass to the api to listen
-	return api.Listen(r)
+	// 3. receive button presses, if configured
+	if secret := os.Getenv("GOBOT_SLACK_SIGNING_SECRET"); secret != "" {
+		addr := os.Getenv("GOBOT_SLACK_INTERACTIONS_ADDR")
+		if addr == "" {
+			addr = DefaultInteractionsAddr
+		}
+		go r.serveInteractions(addr, secret)
+	}
+
+	// 4. pass to the api to listen.  The slack client can't be cancelled, so stop waiting on it
+	// once ctx is done; nothing more will be dispatched as commands are refused while shutting down
+	errs := make(chan error, 1)
+	go func() {
+		errs <- api.Listen(r)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// Listener returns the slack listener for use with gobot.Bot
+func Listener(name string) gobot.Listener {
+	return gobot.NewListener("slack", func(ctx context.Context, handler gobot.Handler) error {
+		return Listen(ctx, name, handler)
+	})
+}
+
+// newMatcher matches messages addressed to the bot by name or by @mention e.g. <@U024BE7LH> go list
+func newMatcher(name, userId string) (*regexp.Regexp, error) {
+	pattern := fmt.Sprintf(`\s*(?:%s|<@%s>)[:,]?\s+(.*)$`, name, regexp.QuoteMeta(userId))
+	return regexp.Compile(pattern)
 }
 
 type robot struct {
+	ctx     context.Context
 	api     *slack.Client
+	web     *web
 	name    string
+	userId  string
+	threads Threads
 	matcher *regexp.Regexp
 	handler gobot.Handler
 }
 
 func (r robot) OnMessage(event slack.MessageEvent) error {
 	log.WithField("provider", "slackbot").Debugf("[RAW] => %s", event.Text)
+
+	// never handle our own messages, or those of other bots, lest we answer them
+	if event.User == r.userId || event.SubType == "bot_message" {
+		return nil
+	}
+
+	// direct messages are always addressed to us, with or without the name
+	text := ""
 	if matches := r.matcher.FindStringSubmatch(event.Text); len(matches) > 1 {
-		text := strings.TrimSpace(matches[1])
+		text = strings.TrimSpace(matches[1])
+	} else if isDirect(event.Channel) {
+		text = strings.TrimSpace(event.Text)
+	}
 
+	if text != "" {
 		log.WithField("provider", "slackbot").Debugf("[IN]  => %s", text)
-		ctx := &gobot.Context{
-			User: event.User,
-			Text: text,
-		}
-		if response, ok := r.handler.OnMessage(ctx); ok {
-			r.respond(event, response)
+
+		// handle each message on its own goroutine so a slow command doesn't hold up the event loop
+		go r.dispatch(event, r.newContext(event, text))
+
+	} else if answerer, ok := r.handler.(gobot.Answerer); ok {
+		// not addressed to us, but it may be the answer to a question we asked
+		if answerer.Answer(r.newContext(event, strings.TrimSpace(event.Text))) {
+			log.WithField("provider", "slackbot").Debugf("[ANS] => %s", event.Text)
 		}
 	}
 
 	return nil
 }
 
-func (r robot) respond(event slack.MessageEvent, response *gobot.Response) error {
+func (r robot) newContext(event slack.MessageEvent, text string) *gobot.Context {
+	ctx := &gobot.Context{
+		Context: r.ctx,
+		User:    event.User,
+		Channel: event.Channel,
+		Text:    text,
+		Thread:  r.threads.thread(event.Channel, event.Ts, event.ThreadTs),
+		Private: isDirect(event.Channel),
+	}
+	ctx.Sender = gobot.SenderFunc(func(response *gobot.Response) error {
+		return r.respond(event, ctx.Thread, response)
+	})
+	return ctx
+}
+
+// isDirect returns true for direct message channels, whose ids begin with D
+func isDirect(channel string) bool {
+	return strings.HasPrefix(channel, "D")
+}
+
+func (r robot) dispatch(event slack.MessageEvent, ctx *gobot.Context) {
+	if response, ok := r.handler.OnMessage(ctx); ok {
+		if err := r.respond(event, ctx.Thread, response); err != nil {
+			log.WithField("provider", "slackbot").Warnf("unable to respond to '%s' => %s", ctx.Text, err.Error())
+		}
+	}
+}
+
+func (r robot) respond(event slack.MessageEvent, thread string, response *gobot.Response) error {
 	if log.GetLevel() == log.DebugLevel {
 		text := response.Text
 		if i := strings.Index(text, "\n"); i > 0 {
@@ -79,43 +178,39 @@ func (r robot) respond(event slack.MessageEvent, response *gobot.Response) error
 		log.WithField("provider", "slackbot").Debugf("[OUT] => %s", text)
 	}
 
-	// send text messages
+	thread = r.threads.reply(event.Channel, event.Ts, thread, response.Text)
+
+	// send text messages, using blocks when the response has them; text remains as the fallback
+	// shown in notifications
 	if response.Text != "" {
-		err := r.respondText(event.Channel, response.Text)
+		_, err := r.web.postMessage(message{
+			Channel:  event.Channel,
+			Text:     response.Text,
+			Blocks:   renderBlocks(response.Blocks),
+			ThreadTs: thread,
+			Username: r.name,
+		})
 		if err != nil {
 			return err
 		}
 	}
 
 	// upload attachments
-	if response.Attachments != nil {
-		for _, a := range response.Attachments {
-			req := &slack.FilesUploadReq{
-				Content:  a.Content,
-				Filetype: a.ContentType,
-				Filename: a.Filename,
-				Title:    a.Title,
-				Channels: []string{event.Channel},
-			}
-			resp, err := r.api.FilesUpload(req)
-			if err != nil {
-				return err
-			}
-
-			if !resp.Ok {
-				r.respondText(event.Channel, resp.Error)
-				return errors.New(resp.Error)
-			}
+	for _, a := range response.Attachments {
+		if err := r.web.uploadFile(event.Channel, thread, a); err != nil {
+			r.respondText(event.Channel, thread, err.Error())
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (r robot) respondText(channel, text string) error {
-	_, err := r.api.PostMessage(slack.PostMessageReq{
+func (r robot) respondText(channel, thread, text string) error {
+	_, err := r.web.postMessage(message{
 		Channel:  channel,
 		Text:     text,
+		ThreadTs: thread,
 		Username: r.name,
 	})
 	return err
@@ -0,0 +1,94 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/savaki/gobot"
+	"github.com/savaki/slack"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatcher(t *testing.T) {
+	Convey("Given a matcher for the bot", t, func() {
+		matcher, err := newMatcher("gobot", "U024BE7LH")
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect both the name and an @mention to address the bot", func() {
+			So(matcher.FindStringSubmatch("gobot go list"), ShouldResemble, []string{"gobot go list", "go list"})
+			So(matcher.FindStringSubmatch("<@U024BE7LH> go list"), ShouldResemble, []string{"<@U024BE7LH> go list", "go list"})
+			So(matcher.FindStringSubmatch("<@U024BE7LH>: go list"), ShouldResemble, []string{"<@U024BE7LH>: go list", "go list"})
+		})
+
+		Convey("Then I expect mentions of other users to be ignored", func() {
+			So(matcher.FindStringSubmatch("<@U999> go list"), ShouldBeNil)
+		})
+	})
+
+	Convey("Then I expect direct message channels to be detected", t, func() {
+		So(isDirect("D024BE91L"), ShouldBeTrue)
+		So(isDirect("C024BE91L"), ShouldBeFalse)
+	})
+}
+
+func TestOnMessage(t *testing.T) {
+	Convey("Given a slack robot", t, func() {
+		posts := make(chan message, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			m := message{}
+			json.NewDecoder(req.Body).Decode(&m)
+			posts <- m
+			json.NewEncoder(w).Encode(webResponse{Ok: true, Ts: "2.0"})
+		}))
+		defer server.Close()
+
+		handler := gobot.Handlers{}.WithCommands(&gobot.Command{
+			Grammar: "hello",
+			Action:  func(c *gobot.Context) { c.Respond("gobot hello") },
+		})
+		So(handler.OnLoad(), ShouldBeNil)
+
+		matcher, err := newMatcher("gobot", "UBOT")
+		So(err, ShouldBeNil)
+
+		r := robot{
+			ctx:     context.Background(),
+			web:     &web{url: server.URL + "/", token: "token", http: http.DefaultClient},
+			name:    "gobot",
+			userId:  "UBOT",
+			matcher: matcher,
+			handler: handler,
+		}
+
+		Convey("When messages from the bot itself and other bots arrive", func() {
+			So(r.OnMessage(slack.MessageEvent{Channel: "D1", User: "UBOT", Text: "gobot hello", Ts: "1.0"}), ShouldBeNil)
+			So(r.OnMessage(slack.MessageEvent{Channel: "C1", SubType: "bot_message", Text: "gobot hello", Ts: "1.1"}), ShouldBeNil)
+
+			Convey("Then I expect neither to be handled", func() {
+				select {
+				case m := <-posts:
+					So(m.Text, ShouldBeEmpty)
+				case <-time.After(100 * time.Millisecond):
+				}
+			})
+		})
+
+		Convey("When a user's message arrives", func() {
+			So(r.OnMessage(slack.MessageEvent{Channel: "D1", User: "U1", Text: "hello", Ts: "1.2"}), ShouldBeNil)
+
+			Convey("Then I expect it to be answered", func() {
+				select {
+				case m := <-posts:
+					So(m.Channel, ShouldEqual, "D1")
+					So(m.Text, ShouldEqual, "gobot hello")
+				case <-time.After(5 * time.Second):
+					So("timed out waiting for a reply", ShouldBeEmpty)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package slackbot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ThreadMode controls whether replies are posted to the channel or into a thread
+type ThreadMode string
+
+const (
+	// ThreadReply replies within the thread a command was posted in, otherwise to the channel
+	ThreadReply ThreadMode = "reply"
+
+	// ThreadMultiline is ThreadReply, but also starts a thread on the command for responses that
+	// span more than one line
+	ThreadMultiline ThreadMode = "multiline"
+
+	// ThreadAlways starts a thread on every command
+	ThreadAlways ThreadMode = "always"
+
+	// ThreadNever posts every reply to the channel, even for commands posted in a thread
+	ThreadNever ThreadMode = "never"
+)
+
+// Threads assigns a ThreadMode to each channel id.  The "*" entry applies to channels that aren't
+// listed and defaults to ThreadReply.
+type Threads map[string]ThreadMode
+
+// ParseThreads parses a comma separated list of channel=mode pairs e.g. *=multiline,C024BE91L=never
+func ParseThreads(s string) (Threads, error) {
+	threads := Threads{}
+
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		segments := strings.SplitN(pair, "=", 2)
+		if len(segments) != 2 {
+			return nil, fmt.Errorf("invalid thread setting, %s; expected channel=mode", pair)
+		}
+
+		channel, mode := strings.TrimSpace(segments[0]), ThreadMode(strings.TrimSpace(segments[1]))
+		switch mode {
+		case ThreadReply, ThreadMultiline, ThreadAlways, ThreadNever:
+			threads[channel] = mode
+		default:
+			return nil, fmt.Errorf("invalid thread mode for %s, %s; expected reply, multiline, always or never", channel, mode)
+		}
+	}
+
+	return threads, nil
+}
+
+// Mode returns the ThreadMode for the channel
+func (t Threads) Mode(channel string) ThreadMode {
+	if mode, ok := t[channel]; ok {
+		return mode
+	}
+	if mode, ok := t["*"]; ok {
+		return mode
+	}
+	return ThreadReply
+}
+
+// thread returns the thread a command posted at ts, within thread, should be answered in
+func (t Threads) thread(channel, ts, thread string) string {
+	switch t.Mode(channel) {
+	case ThreadNever:
+		return ""
+	case ThreadAlways:
+		if thread == "" {
+			return ts
+		}
+	}
+	return thread
+}
+
+// reply returns the thread text should be posted to
+func (t Threads) reply(channel, ts, thread, text string) string {
+	if thread == "" && t.Mode(channel) == ThreadMultiline && strings.Contains(strings.TrimSpace(text), "\n") {
+		return ts
+	}
+	return thread
+}
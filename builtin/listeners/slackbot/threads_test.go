@@ -0,0 +1,42 @@
+package slackbot
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestThreads(t *testing.T) {
+	Convey("Given thread settings", t, func() {
+		threads, err := ParseThreads("*=multiline, C1=never,C2=always")
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect unlisted channels to use the default", func() {
+			So(threads.Mode("C3"), ShouldEqual, ThreadMultiline)
+			So(Threads{}.Mode("C3"), ShouldEqual, ThreadReply)
+		})
+
+		Convey("Then I expect commands posted in a thread to be answered there, unless the channel never threads", func() {
+			So(threads.thread("C3", "2.0", "1.0"), ShouldEqual, "1.0")
+			So(threads.thread("C1", "2.0", "1.0"), ShouldEqual, "")
+		})
+
+		Convey("Then I expect always to start a thread on the command", func() {
+			So(threads.thread("C2", "2.0", ""), ShouldEqual, "2.0")
+		})
+
+		Convey("Then I expect multiline to start a thread only for multi-line responses", func() {
+			So(threads.reply("C3", "2.0", "", "one line"), ShouldEqual, "")
+			So(threads.reply("C3", "2.0", "", "line one\nline two"), ShouldEqual, "2.0")
+			So(threads.reply("C1", "2.0", "", "line one\nline two"), ShouldEqual, "")
+		})
+	})
+
+	Convey("Given invalid thread settings", t, func() {
+		_, err := ParseThreads("C1=sometimes")
+
+		Convey("Then I expect an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,140 @@
+package slackbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/savaki/gobot"
+)
+
+const (
+	DefaultWebAPI = "https://slack.com/api/"
+)
+
+// web calls the slack web api directly for the features the slack client doesn't expose e.g.
+// posting into threads
+type web struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+func newWeb(token string) *web {
+	return &web{
+		url:   DefaultWebAPI,
+		token: token,
+		http:  http.DefaultClient,
+	}
+}
+
+type message struct {
+	Channel  string        `json:"channel"`
+	Text     string        `json:"text,omitempty"`
+	Blocks   []interface{} `json:"blocks,omitempty"`
+	ThreadTs string        `json:"thread_ts,omitempty"`
+	Username string        `json:"username,omitempty"`
+
+	// Ts identifies the message to replace when updating
+	Ts string `json:"ts,omitempty"`
+}
+
+type webResponse struct {
+	Ok     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Ts     string `json:"ts,omitempty"`
+	UserId string `json:"user_id,omitempty"`
+}
+
+func (w *web) do(method, contentType string, body io.Reader) (*webResponse, error) {
+	req, err := http.NewRequest("POST", w.url+method, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.token)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("slack %s failed with status %d", method, resp.StatusCode)
+	}
+
+	result := &webResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	if !result.Ok {
+		return result, errors.New(result.Error)
+	}
+	return result, nil
+}
+
+// authTest returns the user id of the bot the token belongs to
+func (w *web) authTest() (string, error) {
+	resp, err := w.do("auth.test", "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.UserId, nil
+}
+
+// postMessage posts the message, returning its ts
+func (w *web) postMessage(m message) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := w.do("chat.postMessage", "application/json; charset=utf-8", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	return resp.Ts, nil
+}
+
+// updateMessage replaces the text and blocks of the message identified by m.Ts
+func (w *web) updateMessage(m message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.do("chat.update", "application/json; charset=utf-8", bytes.NewReader(data))
+	return err
+}
+
+// uploadFile shares the attachment with the channel, within the thread if one is provided.  The
+// file type is left for slack to detect.
+func (w *web) uploadFile(channel, thread string, a gobot.Attachment) error {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	mw.WriteField("channels", channel)
+	if thread != "" {
+		mw.WriteField("thread_ts", thread)
+	}
+	mw.WriteField("filename", a.Filename)
+	mw.WriteField("title", a.Title)
+
+	part, err := mw.CreateFormFile("file", a.Filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, a.Content); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	_, err = w.do("files.upload", mw.FormDataContentType(), buf)
+	return err
+}
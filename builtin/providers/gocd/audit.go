@@ -0,0 +1,82 @@
+package gocd
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+)
+
+// auditEntry describes a single change made to the Go server and who made it
+type auditEntry struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Channel     string    `json:"channel"`
+	ConfirmedBy string    `json:"confirmed_by,omitempty"`
+	Action      string    `json:"action"`
+	Target      string    `json:"target"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// auditor records every change made to the Go server, successful or not.  Entries are always
+// logged and, if path is set, appended to path as json lines.
+type auditor struct {
+	mutex sync.Mutex
+	path  string
+}
+
+func (a *auditor) record(c *gobot.Context, action, target string, err error) {
+	entry := auditEntry{
+		Time:        time.Now().UTC(),
+		User:        c.User,
+		Channel:     c.Channel,
+		ConfirmedBy: c.ConfirmedBy,
+		Action:      action,
+		Target:      target,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	log.WithFields(log.Fields{
+		"provider":     "gocd",
+		"user":         entry.User,
+		"channel":      entry.Channel,
+		"confirmed-by": entry.ConfirmedBy,
+		"action":       entry.Action,
+		"target":       entry.Target,
+		"error":        entry.Error,
+	}).Info("audit")
+
+	if a == nil || a.path == "" {
+		return
+	}
+
+	if err := a.append(entry); err != nil {
+		log.WithField("provider", "gocd").Errorf("unable to write audit log, %s => %s", a.path, err.Error())
+	}
+}
+
+func (a *auditor) append(entry auditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,284 @@
+package gocd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// api versions for each of the Go server endpoints we call directly
+const (
+	acceptV1        = "application/vnd.go.cd.v1+json"
+	acceptConfig    = "application/vnd.go.cd.v11+json"
+	acceptRun       = "application/vnd.go.cd.v2+json"
+	acceptStages    = "application/vnd.go.cd.v3+json"
+	acceptDashboard = "application/vnd.go.cd.v3+json"
+)
+
+// client calls the Go server's REST api directly for the features goapi doesn't cover
+type client struct {
+	codebase string
+	username string
+	password string
+	http     *http.Client
+}
+
+func clientFromEnv() (*client, error) {
+	codebase := os.Getenv("GOBOT_GO_CODEBASE")
+	if codebase == "" {
+		return nil, fmt.Errorf("GOBOT_GO_CODEBASE environment variable not defined")
+	}
+
+	return &client{
+		codebase: strings.TrimSuffix(codebase, "/"),
+		username: os.Getenv("GOBOT_GO_USERNAME"),
+		password: os.Getenv("GOBOT_GO_PASSWORD"),
+		http:     http.DefaultClient,
+	}, nil
+}
+
+func (c *client) do(ctx context.Context, method, path, accept string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.codebase+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", accept)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if method != "GET" {
+		// required by the Go server for requests that change state
+		req.Header.Set("X-GoCD-Confirm", "true")
+	}
+	if c.username != "" && c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		m := message{}
+		if json.Unmarshal(data, &m) == nil && m.Message != "" {
+			return fmt.Errorf("Go server returned %d => %s", resp.StatusCode, m.Message)
+		}
+		return fmt.Errorf("Go server returned %d for %s %s", resp.StatusCode, method, path)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// -------------------------------------------------------
+
+type variable struct {
+	Name   string `json:"name"`
+	Value  string `json:"value,omitempty"`
+	Secure bool   `json:"secure"`
+}
+
+type pipelineConfig struct {
+	Name                 string     `json:"name"`
+	EnvironmentVariables []variable `json:"environment_variables"`
+}
+
+// pipelineConfig returns the configuration of the pipeline
+func (c *client) pipelineConfig(ctx context.Context, pipeline string) (*pipelineConfig, error) {
+	config := &pipelineConfig{}
+	err := c.do(ctx, "GET", "/go/api/admin/pipelines/"+url.PathEscape(pipeline), acceptConfig, nil, config)
+	return config, err
+}
+
+type material struct {
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+type modification struct {
+	Revision     string `json:"revision"`
+	UserName     string `json:"user_name"`
+	Comment      string `json:"comment"`
+	ModifiedTime int64  `json:"modified_time"`
+}
+
+type materialRevision struct {
+	Material      material       `json:"material"`
+	Changed       bool           `json:"changed"`
+	Modifications []modification `json:"modifications"`
+}
+
+type transition struct {
+	State           string `json:"state"`
+	StateChangeTime int64  `json:"state_change_time"` // milliseconds since the epoch
+}
+
+type job struct {
+	Name        string       `json:"name"`
+	State       string       `json:"state"`
+	Result      string       `json:"result"`
+	Transitions []transition `json:"job_state_transitions"`
+}
+
+type stage struct {
+	Name         string `json:"name"`
+	Counter      string `json:"counter"`
+	Status       string `json:"status"`
+	Result       string `json:"result"`
+	Scheduled    bool   `json:"scheduled"`
+	ApprovalType string `json:"approval_type"`
+	Jobs         []job  `json:"jobs"`
+}
+
+type instance struct {
+	Name       string `json:"name"`
+	Counter    int    `json:"counter"`
+	Label      string `json:"label"`
+	BuildCause struct {
+		Approver          string             `json:"approver"`
+		TriggerForced     bool               `json:"trigger_forced"`
+		TriggerMessage    string             `json:"trigger_message"`
+		MaterialRevisions []materialRevision `json:"material_revisions"`
+	} `json:"build_cause"`
+	Stages []stage `json:"stages"`
+}
+
+// history returns the most recent runs of the pipeline, newest first
+func (c *client) history(ctx context.Context, pipeline string) ([]instance, error) {
+	result := struct {
+		Pipelines []instance `json:"pipelines"`
+	}{}
+	err := c.do(ctx, "GET", "/go/api/pipelines/"+url.PathEscape(pipeline)+"/history", acceptV1, nil, &result)
+	return result.Pipelines, err
+}
+
+// stageInstance returns a single run of a stage, including when each of its jobs changed state
+func (c *client) stageInstance(ctx context.Context, pipeline string, counter int, stageName, stageCounter string) (*stage, error) {
+	result := &stage{}
+	err := c.do(ctx, "GET", stagePath(pipeline, counter, stageName)+"/"+url.PathEscape(stageCounter), acceptStages, nil, result)
+	return result, err
+}
+
+// instance returns a single run of the pipeline
+func (c *client) instance(ctx context.Context, pipeline string, counter int) (*instance, error) {
+	result := &instance{}
+	err := c.do(ctx, "GET", fmt.Sprintf("/go/api/pipelines/%s/%d", url.PathEscape(pipeline), counter), acceptV1, nil, result)
+	return result, err
+}
+
+// link returns the url of the pipeline run's value stream map
+func (c *client) link(pipeline string, counter int) string {
+	return fmt.Sprintf("%s/go/pipelines/value_stream_map/%s/%d", c.codebase, url.PathEscape(pipeline), counter)
+}
+
+type materialSelection struct {
+	Fingerprint string `json:"fingerprint"`
+	Revision    string `json:"revision"`
+}
+
+type scheduleRequest struct {
+	EnvironmentVariables []variable          `json:"environment_variables,omitempty"`
+	Materials            []materialSelection `json:"materials,omitempty"`
+	UpdateMaterials      bool                `json:"update_materials_before_scheduling"`
+}
+
+// schedule triggers the pipeline with the materials and variables provided
+func (c *client) schedule(ctx context.Context, pipeline string, req scheduleRequest) error {
+	return c.do(ctx, "POST", "/go/api/pipelines/"+url.PathEscape(pipeline)+"/schedule", acceptV1, req, nil)
+}
+
+// message is the body the Go server returns for requests that change state
+type message struct {
+	Message string `json:"message"`
+}
+
+func stagePath(pipeline string, counter int, stage string) string {
+	return fmt.Sprintf("/go/api/stages/%s/%d/%s", url.PathEscape(pipeline), counter, url.PathEscape(stage))
+}
+
+// runStage runs a stage that's waiting on manual approval
+func (c *client) runStage(ctx context.Context, pipeline string, counter int, stage string) error {
+	return c.do(ctx, "POST", stagePath(pipeline, counter, stage)+"/run", acceptRun, nil, nil)
+}
+
+// cancelStage cancels a running stage
+func (c *client) cancelStage(ctx context.Context, pipeline string, counter int, stage, stageCounter string) error {
+	return c.do(ctx, "POST", stagePath(pipeline, counter, stage)+"/"+url.PathEscape(stageCounter)+"/cancel", acceptStages, nil, nil)
+}
+
+// rerunFailedJobs reruns only the jobs of the stage that failed
+func (c *client) rerunFailedJobs(ctx context.Context, pipeline string, counter int, stage, stageCounter string) error {
+	return c.do(ctx, "POST", stagePath(pipeline, counter, stage)+"/"+url.PathEscape(stageCounter)+"/run-failed-jobs", acceptStages, nil, nil)
+}
+
+type pauseInfo struct {
+	Paused      bool   `json:"paused"`
+	PausedBy    string `json:"paused_by"`
+	PauseReason string `json:"pause_reason"`
+}
+
+type dashboardPipeline struct {
+	Name      string    `json:"name"`
+	Locked    bool      `json:"locked"`
+	PauseInfo pauseInfo `json:"pause_info"`
+}
+
+type dashboardGroup struct {
+	Name      string   `json:"name"`
+	Pipelines []string `json:"pipelines"`
+}
+
+type dashboard struct {
+	Embedded struct {
+		Groups    []dashboardGroup    `json:"pipeline_groups"`
+		Pipelines []dashboardPipeline `json:"pipelines"`
+	} `json:"_embedded"`
+}
+
+// dashboard returns every pipeline along with its group and whether it's paused or locked
+func (c *client) dashboard(ctx context.Context) (*dashboard, error) {
+	result := &dashboard{}
+	err := c.do(ctx, "GET", "/go/api/dashboard", acceptDashboard, nil, result)
+	return result, err
+}
+
+// pause stops the pipeline from being scheduled until it's unpaused
+func (c *client) pause(ctx context.Context, pipeline, cause string) error {
+	req := struct {
+		PauseCause string `json:"pause_cause"`
+	}{cause}
+	return c.do(ctx, "POST", "/go/api/pipelines/"+url.PathEscape(pipeline)+"/pause", acceptV1, req, nil)
+}
+
+func (c *client) unpause(ctx context.Context, pipeline string) error {
+	return c.do(ctx, "POST", "/go/api/pipelines/"+url.PathEscape(pipeline)+"/unpause", acceptV1, nil, nil)
+}
+
+// unlock releases a pipeline left locked by a failed run
+func (c *client) unlock(ctx context.Context, pipeline string) error {
+	return c.do(ctx, "POST", "/go/api/pipelines/"+url.PathEscape(pipeline)+"/unlock", acceptV1, nil, nil)
+}
@@ -8,12 +8,28 @@
 //   GOBOT_GO_CODEBASE
 //   GOBOT_GO_USERNAME
 //   GOBOT_GO_PASSWORD
+//   GOBOT_GO_CONFIRM - who must confirm builds, once the pipeline and options are resolved, and other changes: none, self (default), or other
+//   GOBOT_GO_ROLE - role required to use any go command; optional
+//   GOBOT_GO_BUILD_ROLE - role required to schedule pipelines; defaults to deployer
+//   GOBOT_GO_MFA - set to true to require an mfa code to schedule pipelines and to approve, cancel, or rerun stages
+//   GOBOT_GO_WATCH - set to true to follow every scheduled pipeline, as if watch were given
+//   GOBOT_GO_APPROVE_ROLE - role required to approve manual stages; defaults to GOBOT_GO_BUILD_ROLE
+//   GOBOT_GO_AUDIT_FILE - file that every change made through the bot is appended to; optional
 //
 // Commands:
 //   gobot go b <pipeline> - builds the pipeline specified by pipeline. List pipelines to get the list of pipelines.
-//   gobot go build <pipeline> - builds the specified Go pipeline
+//   gobot go build <pipeline> [rev=<sha>] [env.NAME=value ...] [watch] [<mfa code>] - builds the specified Go pipeline, optionally at a specific revision with environment variables.  watch reports progress until the run finishes
+//   gobot go approve <pipeline>/<counter>/<stage> - runs a stage that's waiting on manual approval
+//   gobot go cancel <pipeline>/<counter>/<stage>[/<stage counter>] - cancels a running stage
+//   gobot go rerun <pipeline>/<counter>/<stage>[/<stage counter>] - reruns the failed jobs of a stage
+//   gobot go pause <target> [<reason>] - pauses pipelines; target is a pipeline, group:<group>, or a glob e.g. payments-*, which must be confirmed if it matches more than one
+//   gobot go unpause <target> - unpauses pipelines
+//   gobot go unlock <target> - unlocks pipelines
+//   gobot go paused - lists paused and locked pipelines, with who paused them and why
 //   gobot go list - lists Go pipelines
 //   gobot go last <pipeline> - Details about the last build for the specified Go pipeline
+//   gobot go history <pipeline> [n] - the last n runs of the pipeline with what changed and how each stage went
+//   gobot go show <pipeline>/<counter> - details of a single run, including each job
 //   gobot go status - lists failing builds
 
 //
@@ -23,15 +39,29 @@
 package gocd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/savaki/goapi"
 	"github.com/savaki/gobot"
 )
 
+const (
+	// DefaultTimeout limits how long we'll wait on the Go server before giving up
+	DefaultTimeout = 30 * time.Second
+
+	// PromptTimeout is used by commands that may ask the user to choose between pipelines
+	PromptTimeout = DefaultTimeout + gobot.DefaultConversationTimeout
+
+	// MaxButtons limits how many rebuild buttons accompany the list of failed builds
+	MaxButtons = 5
+)
+
 func Provider() *gobot.Provider {
 	// use environment variables to instantiate the goapi
 	api, err := goapi.FromEnv()
@@ -40,38 +70,157 @@ func Provider() *gobot.Provider {
 		return nil
 	}
 
+	// determine who must confirm a build before it's scheduled
+	policy := os.Getenv("GOBOT_GO_CONFIRM")
+	if policy == "" {
+		policy = "self"
+	}
+	confirm, err := gobot.ParseConfirmation(policy)
+	if err != nil {
+		log.Infof("Unable to load Go provider.  Go grammars will not be available. => %s", err.Error())
+		return nil
+	}
+
+	buildRole := os.Getenv("GOBOT_GO_BUILD_ROLE")
+	if buildRole == "" {
+		buildRole = "deployer"
+	}
+	approveRole := os.Getenv("GOBOT_GO_APPROVE_ROLE")
+	if approveRole == "" {
+		approveRole = buildRole
+	}
+	mfa := os.Getenv("GOBOT_GO_MFA") == "true"
+
+	// scheduling with options calls the Go server directly
+	client, err := clientFromEnv()
+	if err != nil {
+		log.Infof("Unable to load Go provider.  Go grammars will not be available. => %s", err.Error())
+		return nil
+	}
+
 	// associate all our commands with the handler
 
-	r := &receiver{api: api}
+	r := &receiver{
+		api:       api,
+		client:    client,
+		audit:     &auditor{path: os.Getenv("GOBOT_GO_AUDIT_FILE")},
+		watch:     os.Getenv("GOBOT_GO_WATCH") == "true",
+		confirm:   confirm,
+		buildRole: buildRole,
+	}
 	return &gobot.Provider{
 		Name: "go",
+		Role: os.Getenv("GOBOT_GO_ROLE"),
 		Commands: []gobot.Command{
 			{
-				Grammars: []string{`go b (\S+)`, `go build (\S+)`},
+				// confirmed by the action once the pipeline and options are resolved
+				Grammars: []string{"go b <pipeline> [<options:text>]", "go build <pipeline> [<options:text>]"},
 				Summary:  "schedule a pipeline to run",
 				Action:   r.scheduledPipeline,
+				Timeout:  PromptTimeout + gobot.DefaultConfirmationTimeout,
+				Role:     buildRole,
+				MFA:      mfa,
+			},
+			{
+				Grammar: "go approve <run>",
+				Summary: "approve a stage waiting on manual approval e.g. api/12/deploy",
+				Action:  r.approve,
+				Timeout: DefaultTimeout,
+				Confirm: confirm,
+				Role:    approveRole,
+				MFA:     mfa,
+			},
+			{
+				Grammar: "go cancel <run>",
+				Summary: "cancel a running stage e.g. api/12/test",
+				Action:  r.cancel,
+				Timeout: DefaultTimeout,
+				Confirm: confirm,
+				Role:    buildRole,
+				MFA:     mfa,
+			},
+			{
+				Grammar: "go rerun <run>",
+				Summary: "rerun the failed jobs of a stage e.g. api/12/test",
+				Action:  r.rerun,
+				Timeout: DefaultTimeout,
+				Confirm: confirm,
+				Role:    buildRole,
+				MFA:     mfa,
+			},
+			{
+				// pausing is how we freeze deploys during an incident, so a single pipeline doesn't wait
+				// on confirmation.  Groups and globs are confirmed by the action, within its timeout.
+				Grammar: "go pause <target> [<reason:text>]",
+				Summary: "pause a pipeline, group:<group>, or pipelines matching a glob",
+				Action:  r.pause,
+				Timeout: DefaultTimeout + gobot.DefaultConfirmationTimeout,
+				Role:    buildRole,
+			},
+			{
+				Grammar: "go unpause <target>",
+				Summary: "unpause a pipeline, group:<group>, or pipelines matching a glob",
+				Action:  r.unpause,
+				Timeout: DefaultTimeout,
+				Confirm: confirm,
+				Role:    buildRole,
+			},
+			{
+				Grammar: "go unlock <target>",
+				Summary: "unlock a pipeline, group:<group>, or pipelines matching a glob",
+				Action:  r.unlock,
+				Timeout: DefaultTimeout,
+				Confirm: confirm,
+				Role:    buildRole,
+			},
+			{
+				Grammar: "go paused",
+				Summary: "list paused and locked pipelines",
+				Action:  r.listPaused,
+				Timeout: DefaultTimeout,
 			},
 			{
 				Grammar: "go list",
 				Summary: "list all pipelines",
 				Action:  r.listPipelines,
+				Timeout: DefaultTimeout,
 			},
 			{
-				Grammar: `go last (\S+)`,
+				Grammar: "go last <pipeline>",
 				Summary: "last build status for specified pipeline",
 				Action:  r.lastStatus,
+				Timeout: PromptTimeout,
+			},
+			{
+				Grammar: "go history <pipeline> [<count:int>]",
+				Summary: "recent runs of a pipeline, with changes and stage results",
+				Action:  r.showHistory,
+				Timeout: PromptTimeout,
+			},
+			{
+				Grammar: "go show <run>",
+				Summary: "details of a single run e.g. api/12",
+				Action:  r.showInstance,
+				Timeout: DefaultTimeout,
 			},
 			{
 				Grammar: "go status",
 				Summary: "lists failed builds",
 				Action:  r.failedBuilds,
+				Timeout: DefaultTimeout,
 			},
 		},
 	}
 }
 
 type receiver struct {
-	api *goapi.Client
+	api       *goapi.Client
+	client    *client
+	audit     *auditor
+	watch     bool               // follow every scheduled pipeline
+	poll      time.Duration      // how often watched runs are checked; defaults to PollInterval
+	confirm   gobot.Confirmation // who must confirm builds
+	buildRole string
 }
 
 func apiFromEnv() (*goapi.Client, error) {
@@ -92,10 +241,96 @@ func apiFromEnv() (*goapi.Client, error) {
 	return client, nil
 }
 
+// await calls fn in the background, giving up early if ctx is done first.  goapi doesn't accept a
+// context.Context so this is how we keep a slow Go server from holding onto a command
+func await(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resolvePipeline returns the pipeline called name.  If name isn't an exact match, the user is
+// asked which of the pipelines it partially matches they meant, even if there's only one; a deploy
+// shouldn't go to a pipeline nobody named.
+func (r *receiver) resolvePipeline(c *gobot.Context, name string) (string, error) {
+	var groups []goapi.PipelineGroup
+	err := await(c, func() (err error) {
+		groups, err = r.api.PipelineGroups()
+		return
+	})
+	if err != nil {
+		return "", err
+	}
+
+	names := []string{}
+	for _, g := range groups {
+		for _, p := range g.Pipelines {
+			names = append(names, p.Name)
+		}
+	}
+	return choosePipeline(c, name, names)
+}
+
+// choosePipeline returns name if it's one of names.  Otherwise the user picks one of the names
+// containing it.
+func choosePipeline(c *gobot.Context, name string, names []string) (string, error) {
+	candidates := []string{}
+	for _, n := range names {
+		if n == name {
+			return name, nil
+		}
+		if strings.Contains(strings.ToLower(n), strings.ToLower(name)) {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("Unable to find a pipeline with name, %s", name)
+	}
+
+	question := fmt.Sprintf("%s matches several pipelines.  Which one did you mean?", name)
+	if len(candidates) == 1 {
+		question = fmt.Sprintf("There's no pipeline called %s.  Did you mean this one?  Reply with its name or number.", name)
+	}
+	for i, candidate := range candidates {
+		question = question + fmt.Sprintf("\n %d. %s", i+1, candidate)
+	}
+
+	answer, err := c.Ask(question)
+	if err == gobot.ErrConversationsOffline {
+		return "", fmt.Errorf("Unable to find a pipeline with name, %s.  Did you mean: %s", name, strings.Join(candidates, ", "))
+	} else if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(candidates) {
+		return candidates[n-1], nil
+	}
+	for _, candidate := range candidates {
+		if strings.EqualFold(candidate, answer) {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s isn't one of the pipelines listed", answer)
+}
+
 func (r *receiver) listPipelines(c *gobot.Context) {
 	log.WithField("provider", "gocd").Debugf("#listPipelines")
 
-	groups, err := r.api.PipelineGroups()
+	var groups []goapi.PipelineGroup
+	err := await(c, func() (err error) {
+		groups, err = r.api.PipelineGroups()
+		return
+	})
 	if err != nil {
 		c.Fail(err)
 		return
@@ -112,24 +347,125 @@ func (r *receiver) listPipelines(c *gobot.Context) {
 func (r *receiver) scheduledPipeline(c *gobot.Context) {
 	log.WithField("provider", "gocd").Debugf("#allBuilds")
 
-	pipeline := c.Match(1)
-	if err := r.api.PipelineSchedule(pipeline); err != nil {
+	options, err := parseOptions(c.String("options"))
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	pipeline, err := r.resolvePipeline(c, c.String("pipeline"))
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	// watching needs the latest run so we can tell when the new one appears
+	watch := options.watch || r.watch
+	var history []instance
+	if watch || len(options.revisions) > 0 {
+		if history, err = r.client.history(c, pipeline); err != nil {
+			c.Fail(err)
+			return
+		}
+	}
+	previous := 0
+	if len(history) > 0 {
+		previous = history[0].Counter
+	}
+
+	// validate the options against the pipeline before asking anyone to confirm them
+	var req scheduleRequest
+	var fields []gobot.Field
+	if !options.empty() {
+		config, err := r.client.pipelineConfig(c, pipeline)
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+
+		req, fields, err = options.scheduleRequest(config, history)
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+	}
+
+	// confirm what will actually be scheduled rather than what was typed
+	prompt := fmt.Sprintf("About to schedule `%s`", scheduleTarget(pipeline, fields))
+	if err := c.ConfirmWith(r.confirm, r.buildRole, prompt); err != nil {
 		c.Fail(err)
 		return
 	}
+	started := time.Now()
+
+	if options.empty() {
+		err = await(c, func() error {
+			return r.api.PipelineSchedule(pipeline)
+		})
+		r.audit.record(c, "build", pipeline, err)
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+
+		c.Respond(fmt.Sprintf("Scheduled pipeline, %s", pipeline))
+
+	} else {
+		err = r.client.schedule(c, pipeline, req)
+		r.audit.record(c, "build", scheduleTarget(pipeline, fields), err)
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+
+		c.Respond("").Add(gobot.Section{
+			Text:   fmt.Sprintf("Scheduled pipeline, %s, with:", pipeline),
+			Status: gobot.StatusGood,
+			Fields: fields,
+		})
+	}
+
+	if watch {
+		// the revisions we asked for help the watcher tell our run from any others
+		w := r.newWatcher(pipeline, started, req.Materials)
+		c.Go(func(c *gobot.Context) {
+			w.watch(c, previous)
+		})
+	}
+}
+
+// scheduleTarget describes the pipeline along with the options it's scheduled with
+func scheduleTarget(pipeline string, fields []gobot.Field) string {
+	target := pipeline
+	for _, f := range fields {
+		target = target + " " + f.Name + "=" + f.Value // secure values are already masked
+	}
+	return target
+}
 
-	c.Respond(fmt.Sprintf("Scheduled pipeline, %s", pipeline))
+func (r *receiver) buildStatus(ctx context.Context) (projects []goapi.Project, err error) {
+	err = await(ctx, func() (err error) {
+		projects, err = r.api.BuildStatus()
+		return
+	})
+	return
 }
 
 func (r *receiver) lastStatus(c *gobot.Context) {
 	log.WithField("provider", "gocd").Debugf("#lastStatus")
 
-	projects, err := r.api.BuildStatus()
+	pipeline, err := r.resolvePipeline(c, c.String("pipeline"))
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	projects, err := r.buildStatus(c)
 	if err != nil {
 		c.Fail(err)
+		return
 	}
 
-	pipeline := c.Match(1)
 	filtered := []goapi.Project{}
 	for _, p := range projects {
 		if parts := strings.Split(p.Name, " :: "); len(parts) != 2 {
@@ -145,31 +481,63 @@ func (r *receiver) lastStatus(c *gobot.Context) {
 		return
 	}
 
-	response := c.Respond(fmt.Sprintf("%s:", pipeline))
-	for i, p := range filtered {
-		text := fmt.Sprintf("%d. %s => %s", i+1, p.Name, p.LastBuildStatus)
-		response.Append(text)
+	section := gobot.Section{}
+	for _, p := range filtered {
+		section.Fields = append(section.Fields, gobot.Field{
+			Name:   p.Name,
+			Value:  p.LastBuildStatus,
+			Status: statusOf(p.LastBuildStatus),
+		})
 	}
+	c.Respond(fmt.Sprintf("%s:", pipeline)).Add(section)
 }
 
 func (r *receiver) failedBuilds(c *gobot.Context) {
 	log.WithField("provider", "gocd").Debugf("#failedBuilds")
 
-	projects, err := r.api.BuildStatus()
+	projects, err := r.buildStatus(c)
 	if err != nil {
 		c.Fail(err)
+		return
 	}
 
 	failed := goapi.OnlyFailedBuilds(projects)
 
 	if len(failed) == 0 {
-		c.Respond("All builds running green!")
+		c.Respond("").Add(gobot.Section{Text: "All builds running green!", Status: gobot.StatusGood})
 		return
 	}
 
 	response := c.Respond("Failed builds:")
-	for i, p := range failed {
-		text := fmt.Sprintf("%d. %s => %s", i+1, p.Name, p.LastBuildStatus)
-		response.Append(text)
+	buttons := gobot.Buttons{}
+	rebuild := map[string]bool{}
+	for _, p := range failed {
+		response.Add(gobot.Section{
+			Text:   fmt.Sprintf("%s => %s", p.Name, p.LastBuildStatus),
+			Status: statusOf(p.LastBuildStatus),
+		})
+
+		// offer to rebuild each failed pipeline; pressing the button runs go build as the presser
+		pipeline := strings.Split(p.Name, " :: ")[0]
+		if !rebuild[pipeline] && len(buttons) < MaxButtons {
+			rebuild[pipeline] = true
+			buttons = append(buttons, gobot.Button{
+				Text:  "Rebuild " + pipeline,
+				Value: "go build " + pipeline,
+			})
+		}
+	}
+	response.Add(buttons)
+}
+
+// statusOf colors a cctray build status e.g. Success or Failure
+func statusOf(buildStatus string) gobot.Status {
+	switch buildStatus {
+	case "Success":
+		return gobot.StatusGood
+	case "Failure":
+		return gobot.StatusDanger
+	default:
+		return gobot.StatusWarning
 	}
 }
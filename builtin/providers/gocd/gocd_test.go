@@ -0,0 +1,98 @@
+package gocd
+
+import (
+	"testing"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChoosePipeline(t *testing.T) {
+	names := []string{"api", "api-prod", "web-prod", "web-staging"}
+
+	Convey("Given a pipeline's exact name", t, func() {
+		Convey("Then it's chosen without asking", func() {
+			name, err := choosePipeline(&gobot.Context{}, "api", names)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "api")
+		})
+	})
+
+	Convey("Given a name that matches nothing", t, func() {
+		Convey("Then it's an error", func() {
+			_, err := choosePipeline(&gobot.Context{}, "ledger", names)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a name that partially matches pipelines", t, func() {
+		questions := make(chan string, 1)
+		sender := gobot.SenderFunc(func(r *gobot.Response) error {
+			questions <- r.Text
+			return nil
+		})
+		conversations := gobot.Converse(gobot.Handlers{}.WithCommands(&gobot.Command{
+			Grammar: "choose <name>",
+			Action: func(c *gobot.Context) {
+				name, err := choosePipeline(c, c.String("name"), names)
+				if err != nil {
+					c.Fail(err)
+					return
+				}
+				c.Respond("chose " + name)
+			},
+		}))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		choose := func(name string) chan *gobot.Response {
+			responses := make(chan *gobot.Response, 1)
+			go func() {
+				response, _ := conversations.OnMessage(&gobot.Context{User: "matt", Channel: "ops", Text: "choose " + name, Sender: sender})
+				responses <- response
+			}()
+			return responses
+		}
+		answer := func(text string) {
+			So(conversations.Answer(&gobot.Context{User: "matt", Channel: "ops", Text: text}), ShouldBeTrue)
+		}
+
+		Convey("When only one pipeline matches", func() {
+			responses := choose("staging")
+
+			Convey("Then the user is still asked to pick it", func() {
+				So(<-questions, ShouldEqual, "There's no pipeline called staging.  Did you mean this one?  Reply with its name or number.\n 1. web-staging")
+				answer("1")
+				So((<-responses).Text, ShouldEqual, "chose web-staging")
+			})
+		})
+
+		Convey("When several pipelines match", func() {
+			responses := choose("prod")
+
+			Convey("Then the user picks one by name", func() {
+				So(<-questions, ShouldEqual, "prod matches several pipelines.  Which one did you mean?\n 1. api-prod\n 2. web-prod")
+				answer("web-prod")
+				So((<-responses).Text, ShouldEqual, "chose web-prod")
+			})
+		})
+	})
+
+	Convey("Given a partial match from a listener that can't ask", t, func() {
+		Convey("Then the candidates are listed in the error", func() {
+			_, err := choosePipeline(&gobot.Context{}, "staging", names)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Unable to find a pipeline with name, staging.  Did you mean: web-staging")
+		})
+	})
+}
+
+func TestScheduleTarget(t *testing.T) {
+	Convey("Given the options a pipeline is scheduled with", t, func() {
+		fields := []gobot.Field{{Name: "api-repo", Value: "0123abc"}, {Name: "env.TOKEN", Value: masked}}
+
+		Convey("Then the target names the resolved pipeline and each option", func() {
+			So(scheduleTarget("api-prod", fields), ShouldEqual, "api-prod api-repo=0123abc env.TOKEN="+masked)
+			So(scheduleTarget("api-prod", nil), ShouldEqual, "api-prod")
+		})
+	})
+}
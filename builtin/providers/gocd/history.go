@@ -0,0 +1,288 @@
+package gocd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+)
+
+const (
+	// DefaultHistory is how many runs go history lists when no count is given
+	DefaultHistory = 5
+
+	// MaxHistory is the most runs go history lists; one page of the Go server's history
+	MaxHistory = 10
+
+	// MaxModifications limits how many changes per material are listed for each run
+	MaxModifications = 3
+
+	// MaxConcurrentRequests limits how many stages are timed at once
+	MaxConcurrentRequests = 4
+)
+
+func parseInstance(text string) (string, int, error) {
+	segments := strings.Split(text, "/")
+	if len(segments) != 2 || segments[0] == "" {
+		return "", 0, fmt.Errorf("invalid run, %s; expected <pipeline>/<counter>", text)
+	}
+
+	counter, err := strconv.Atoi(segments[1])
+	if err != nil || counter < 1 {
+		return "", 0, fmt.Errorf("invalid run, %s; expected <pipeline>/<counter>", text)
+	}
+	return segments[0], counter, nil
+}
+
+func (r *receiver) showHistory(c *gobot.Context) {
+	log.WithField("provider", "gocd").Debugf("#showHistory")
+
+	pipeline, err := r.resolvePipeline(c, c.String("pipeline"))
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	count := c.Int("count")
+	if count <= 0 {
+		count = DefaultHistory
+	}
+	if count > MaxHistory {
+		count = MaxHistory
+	}
+
+	history, err := r.client.history(c, pipeline)
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+	if len(history) == 0 {
+		c.Respond(fmt.Sprintf("%s hasn't run yet", pipeline))
+		return
+	}
+	if len(history) > count {
+		history = history[:count]
+	}
+
+	timings := r.timeStages(c, pipeline, history)
+	response := c.Respond(fmt.Sprintf("Last %d runs of %s:", len(history), pipeline))
+	for i, inst := range history {
+		if i > 0 {
+			response.Add(gobot.Divider{})
+		}
+		response.Add(describe(pipeline, inst, false, timings))
+	}
+}
+
+func (r *receiver) showInstance(c *gobot.Context) {
+	log.WithField("provider", "gocd").Debugf("#showInstance")
+
+	pipeline, counter, err := parseInstance(c.String("run"))
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	inst, err := r.client.instance(c, pipeline, counter)
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	timings := r.timeStages(c, pipeline, []instance{*inst})
+	c.Respond("").Add(
+		describe(pipeline, *inst, true, timings),
+		gobot.Buttons{{Text: "Open in GoCD", URL: r.client.link(pipeline, counter)}},
+	)
+}
+
+// describe summarizes a run: what triggered it, what changed, and how each stage went, timed per
+// timeStages.  With jobs, the result of each job is included too.
+func describe(pipeline string, inst instance, jobs bool, timings map[string]time.Duration) gobot.Section {
+	text := fmt.Sprintf("%s/%d", pipeline, inst.Counter)
+	if inst.Label != "" && inst.Label != strconv.Itoa(inst.Counter) {
+		text = text + " (" + inst.Label + ")"
+	}
+	if inst.BuildCause.TriggerMessage != "" {
+		text = text + " - " + inst.BuildCause.TriggerMessage
+	}
+
+	section := gobot.Section{Text: text, Status: statusOfResult(runResult(inst))}
+
+	for _, mr := range inst.BuildCause.MaterialRevisions {
+		if !mr.Changed {
+			continue
+		}
+		name := mr.Material.Name
+		if name == "" {
+			name = mr.Material.Description
+		}
+
+		for i, m := range mr.Modifications {
+			if i == MaxModifications {
+				section.Fields = append(section.Fields, gobot.Field{Name: name, Value: fmt.Sprintf("and %d more", len(mr.Modifications)-i)})
+				break
+			}
+			section.Fields = append(section.Fields, gobot.Field{Name: name, Value: describeModification(m)})
+		}
+	}
+
+	for _, s := range inst.Stages {
+		section.Fields = append(section.Fields, describeStage(inst.Counter, s, timings))
+
+		if !jobs || !s.Scheduled {
+			continue
+		}
+		for _, j := range s.Jobs {
+			value := lower(j.Result)
+			if !completed(j.Result) {
+				value = strings.ToLower(j.State)
+			}
+			section.Fields = append(section.Fields, gobot.Field{Name: s.Name + "/" + j.Name, Value: value, Status: jobStatus(j)})
+		}
+	}
+
+	return section
+}
+
+func describeStage(counter int, s stage, timings map[string]time.Duration) gobot.Field {
+	if !s.Scheduled {
+		return gobot.Field{Name: s.Name, Value: "not run"}
+	}
+
+	value := "building"
+	if completed(s.Result) {
+		value = lower(s.Result)
+	}
+
+	if elapsed, ok := timings[stageKey(counter, s)]; ok {
+		if completed(s.Result) {
+			value = fmt.Sprintf("%s in %v", value, elapsed)
+		} else {
+			value = fmt.Sprintf("%s for %v", value, elapsed)
+		}
+	}
+
+	return gobot.Field{Name: s.Name, Value: value, Status: statusOfResult(s.Result)}
+}
+
+func stageKey(counter int, s stage) string {
+	return fmt.Sprintf("%d/%s/%s", counter, s.Name, s.Counter)
+}
+
+// timeStages returns how long each scheduled stage of the runs took, keyed by stageKey.  The
+// pipeline's history doesn't include timings, so each stage is requested separately,
+// MaxConcurrentRequests at a time.  Stages that can't be timed are left out.
+func (r *receiver) timeStages(c *gobot.Context, pipeline string, insts []instance) map[string]time.Duration {
+	mutex := &sync.Mutex{}
+	timings := map[string]time.Duration{}
+
+	wg := &sync.WaitGroup{}
+	limit := make(chan struct{}, MaxConcurrentRequests)
+	for _, inst := range insts {
+		for _, s := range inst.Stages {
+			if !s.Scheduled {
+				continue
+			}
+
+			wg.Add(1)
+			go func(counter int, s stage) {
+				defer wg.Done()
+				limit <- struct{}{}
+				defer func() { <-limit }()
+
+				detail, err := r.client.stageInstance(c, pipeline, counter, s.Name, s.Counter)
+				if err != nil {
+					log.WithField("provider", "gocd").Warnf("unable to time stage %s/%d/%s => %s", pipeline, counter, s.Name, err.Error())
+					return
+				}
+				if elapsed, ok := duration(detail.Jobs, time.Now()); ok {
+					mutex.Lock()
+					timings[stageKey(counter, s)] = elapsed
+					mutex.Unlock()
+				}
+			}(inst.Counter, s)
+		}
+	}
+	wg.Wait()
+
+	return timings
+}
+
+// runResult is the result of the last stage that ran, or Building if any stage is still running
+func runResult(inst instance) string {
+	result := "Unknown"
+	for _, s := range inst.Stages {
+		if !s.Scheduled {
+			continue
+		}
+		if !completed(s.Result) {
+			return "Building"
+		}
+		result = s.Result
+	}
+	return result
+}
+
+func jobStatus(j job) gobot.Status {
+	if !completed(j.Result) {
+		return gobot.StatusWarning
+	}
+	return statusOfResult(j.Result)
+}
+
+// duration returns the time from the first job being scheduled until the last job completed, or
+// until now if jobs are still running
+func duration(jobs []job, now time.Time) (time.Duration, bool) {
+	var started, finished int64
+	running := false
+
+	for _, j := range jobs {
+		done := false
+		for _, t := range j.Transitions {
+			switch t.State {
+			case "Scheduled":
+				if started == 0 || t.StateChangeTime < started {
+					started = t.StateChangeTime
+				}
+			case "Completed":
+				done = true
+				if t.StateChangeTime > finished {
+					finished = t.StateChangeTime
+				}
+			}
+		}
+		if !done {
+			running = true
+		}
+	}
+
+	if started == 0 {
+		return 0, false
+	}
+	end := time.Unix(0, finished*int64(time.Millisecond))
+	if running {
+		end = now
+	}
+	return end.Sub(time.Unix(0, started*int64(time.Millisecond))) / time.Second * time.Second, true
+}
+
+// describeModification summarizes a change as its short revision, the first line of its comment,
+// and its author
+func describeModification(m modification) string {
+	revision := m.Revision
+	if len(revision) > 8 {
+		revision = revision[:8]
+	}
+
+	comment := strings.TrimSpace(strings.SplitN(m.Comment, "\n", 2)[0])
+	text := strings.TrimSpace(revision + " " + comment)
+	if m.UserName != "" {
+		text = text + " - " + m.UserName
+	}
+	return text
+}
@@ -0,0 +1,172 @@
+package gocd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseInstance(t *testing.T) {
+	Convey("Given a pipeline and counter", t, func() {
+		pipeline, counter, err := parseInstance("api/12")
+
+		Convey("Then both are parsed", func() {
+			So(err, ShouldBeNil)
+			So(pipeline, ShouldEqual, "api")
+			So(counter, ShouldEqual, 12)
+		})
+	})
+
+	Convey("Given malformed runs", t, func() {
+		Convey("Then each is rejected", func() {
+			for _, text := range []string{"api", "api/latest", "/12", "api/12/build", "api/0"} {
+				_, _, err := parseInstance(text)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestDuration(t *testing.T) {
+	at := func(seconds int64) int64 { return seconds * 1000 }
+
+	Convey("Given completed jobs", t, func() {
+		jobs := []job{
+			{Transitions: []transition{{"Scheduled", at(100)}, {"Completed", at(160)}}},
+			{Transitions: []transition{{"Scheduled", at(90)}, {"Completed", at(220)}}},
+		}
+
+		Convey("Then the duration runs from the first scheduled to the last completed", func() {
+			d, ok := duration(jobs, time.Unix(1000, 0))
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, 130*time.Second)
+		})
+	})
+
+	Convey("Given a job still running", t, func() {
+		jobs := []job{
+			{Transitions: []transition{{"Scheduled", at(100)}, {"Completed", at(160)}}},
+			{Transitions: []transition{{"Scheduled", at(100)}, {"Building", at(110)}}},
+		}
+
+		Convey("Then the duration runs until now", func() {
+			d, ok := duration(jobs, time.Unix(400, 0))
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, 300*time.Second)
+		})
+	})
+
+	Convey("Given no transitions", t, func() {
+		Convey("Then there's no duration", func() {
+			_, ok := duration([]job{{}}, time.Now())
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	Convey("Given a run with changes and a failed stage", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/go/api/stages/api/12/test/1" {
+				http.NotFound(w, req)
+				return
+			}
+			json.NewEncoder(w).Encode(stage{Jobs: []job{
+				{Transitions: []transition{{"Scheduled", 100000}, {"Completed", 225000}}},
+			}})
+		}))
+		defer server.Close()
+
+		r := &receiver{client: &client{codebase: server.URL, http: http.DefaultClient}}
+		c := &gobot.Context{Context: context.Background()}
+
+		inst := instance{Counter: 12, Label: "12"}
+		inst.BuildCause.TriggerMessage = "modified by matt"
+		inst.BuildCause.MaterialRevisions = []materialRevision{
+			{
+				Material: material{Name: "api-repo"},
+				Changed:  true,
+				Modifications: []modification{
+					{Revision: "0123456789abcdef", Comment: "Fix login\n\nLonger description", UserName: "matt"},
+					{Revision: "1"}, {Revision: "2"}, {Revision: "3"}, {Revision: "4"},
+				},
+			},
+			{Material: material{Name: "upstream"}, Modifications: []modification{{Revision: "upstream/3"}}},
+		}
+		inst.Stages = []stage{
+			{Name: "test", Counter: "1", Scheduled: true, Result: "Failed", Jobs: []job{{Name: "unit", Result: "Failed"}}},
+			{Name: "deploy", Counter: "1", Result: "Unknown"},
+		}
+
+		section := describe("api", inst, true, r.timeStages(c, "api", []instance{inst}))
+
+		Convey("Then it includes the trigger, what changed, and each stage and job", func() {
+			So(section.Text, ShouldEqual, "api/12 - modified by matt")
+			So(section.Status, ShouldEqual, gobot.StatusDanger)
+			So(section.Fields, ShouldResemble, []gobot.Field{
+				{Name: "api-repo", Value: "01234567 Fix login - matt"},
+				{Name: "api-repo", Value: "1"},
+				{Name: "api-repo", Value: "2"},
+				{Name: "api-repo", Value: "and 2 more"},
+				{Name: "test", Value: "failed in 2m5s", Status: gobot.StatusDanger},
+				{Name: "test/unit", Value: "failed", Status: gobot.StatusDanger},
+				{Name: "deploy", Value: "not run"},
+			})
+		})
+	})
+}
+
+func TestTimeStages(t *testing.T) {
+	Convey("Given several runs with several stages each", t, func() {
+		mutex := &sync.Mutex{}
+		inFlight, most, requests := 0, 0, 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mutex.Lock()
+			inFlight, requests = inFlight+1, requests+1
+			if inFlight > most {
+				most = inFlight
+			}
+			mutex.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+			json.NewEncoder(w).Encode(stage{Jobs: []job{
+				{Transitions: []transition{{"Scheduled", 100000}, {"Completed", 160000}}},
+			}})
+
+			mutex.Lock()
+			inFlight--
+			mutex.Unlock()
+		}))
+		defer server.Close()
+
+		insts := []instance{}
+		for counter := 1; counter <= 5; counter++ {
+			inst := instance{Counter: counter}
+			for _, name := range []string{"build", "test", "deploy"} {
+				inst.Stages = append(inst.Stages, stage{Name: name, Counter: "1", Scheduled: true, Result: "Passed"})
+			}
+			inst.Stages = append(inst.Stages, stage{Name: "release", Counter: "1"})
+			insts = append(insts, inst)
+		}
+
+		r := &receiver{client: &client{codebase: server.URL, http: http.DefaultClient}}
+		timings := r.timeStages(&gobot.Context{Context: context.Background()}, "api", insts)
+
+		Convey("Then each scheduled stage is timed, a few at a time", func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			So(requests, ShouldEqual, 15)
+			So(most, ShouldBeGreaterThan, 1)
+			So(most, ShouldBeLessThanOrEqualTo, MaxConcurrentRequests)
+			So(timings, ShouldHaveLength, 15)
+			So(timings[stageKey(3, stage{Name: "test", Counter: "1"})], ShouldEqual, time.Minute)
+		})
+	})
+}
@@ -0,0 +1,156 @@
+package gocd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/savaki/gobot"
+)
+
+// masked replaces the value of secure variables when echoing what was scheduled
+const masked = "********"
+
+type option struct {
+	name  string
+	value string
+}
+
+// scheduleOptions holds the options that may follow go build <pipeline>:
+//
+//	rev=<sha>               revision of the pipeline's only material
+//	rev.<material>=<sha>    revision of the named material
+//	env.<NAME>=<value>      environment variable, which must be defined by the pipeline
+//	watch                   follow the run, reporting each stage and job as it completes
+type scheduleOptions struct {
+	revisions []option
+	variables []option
+	watch     bool
+}
+
+func (o scheduleOptions) empty() bool {
+	return len(o.revisions) == 0 && len(o.variables) == 0
+}
+
+func parseOptions(text string) (scheduleOptions, error) {
+	options := scheduleOptions{}
+
+	for _, token := range strings.Fields(text) {
+		if token == "watch" {
+			options.watch = true
+			continue
+		}
+
+		segments := strings.SplitN(token, "=", 2)
+		if len(segments) != 2 || segments[1] == "" {
+			return options, fmt.Errorf("invalid option, %s; expected rev=<sha>, env.NAME=value, or watch", token)
+		}
+		key, value := segments[0], segments[1]
+
+		switch {
+		case key == "rev":
+			options.revisions = append(options.revisions, option{value: value})
+		case strings.HasPrefix(key, "rev.") && len(key) > len("rev."):
+			options.revisions = append(options.revisions, option{name: strings.TrimPrefix(key, "rev."), value: value})
+		case strings.HasPrefix(key, "env.") && len(key) > len("env."):
+			options.variables = append(options.variables, option{name: strings.TrimPrefix(key, "env."), value: value})
+		default:
+			return options, fmt.Errorf("invalid option, %s; expected rev=<sha>, env.NAME=value, or watch", token)
+		}
+	}
+
+	return options, nil
+}
+
+// scheduleRequest converts the options into a schedule request, validating them against the
+// pipeline's config and the materials of its most recent run.  fields describes exactly what
+// will be scheduled, with secure values masked.
+func (o scheduleOptions) scheduleRequest(config *pipelineConfig, history []instance) (req scheduleRequest, fields []gobot.Field, err error) {
+	// 1. variables must be defined by the pipeline
+	defined := map[string]variable{}
+	for _, v := range config.EnvironmentVariables {
+		defined[v.Name] = v
+	}
+
+	unknown := []string{}
+	for _, v := range o.variables {
+		d, ok := defined[v.name]
+		if !ok {
+			unknown = append(unknown, v.name)
+			continue
+		}
+
+		req.EnvironmentVariables = append(req.EnvironmentVariables, variable{Name: v.name, Value: v.value, Secure: d.Secure})
+		value := v.value
+		if d.Secure {
+			value = masked
+		}
+		fields = append(fields, gobot.Field{Name: "env." + v.name, Value: value})
+	}
+	if len(unknown) > 0 {
+		return req, nil, fmt.Errorf("%s doesn't define %s.  Defined variables: %s", config.Name, strings.Join(unknown, ", "), names(defined))
+	}
+
+	// 2. revisions need the fingerprint of the material they belong to, which the Go server only
+	// reports for materials that have been built
+	if len(o.revisions) == 0 {
+		return req, fields, nil
+	}
+	if len(history) == 0 {
+		return req, nil, fmt.Errorf("%s hasn't run yet, so its materials are unknown.  Schedule it once without rev= first.", config.Name)
+	}
+
+	materials := []material{}
+	for _, mr := range history[0].BuildCause.MaterialRevisions {
+		if !strings.EqualFold(mr.Material.Type, "Pipeline") {
+			materials = append(materials, mr.Material)
+		}
+	}
+
+	for _, rev := range o.revisions {
+		m, err := findMaterial(config.Name, materials, rev.name)
+		if err != nil {
+			return req, nil, err
+		}
+
+		req.Materials = append(req.Materials, materialSelection{Fingerprint: m.Fingerprint, Revision: rev.value})
+		fields = append(fields, gobot.Field{Name: m.Name, Value: rev.value})
+	}
+	req.UpdateMaterials = true
+
+	return req, fields, nil
+}
+
+func findMaterial(pipeline string, materials []material, name string) (material, error) {
+	available := []string{}
+	for _, m := range materials {
+		available = append(available, m.Name)
+	}
+
+	if name == "" {
+		if len(materials) == 1 {
+			return materials[0], nil
+		}
+		return material{}, fmt.Errorf("%s has %d materials.  Use rev.<material>=<sha> with one of: %s", pipeline, len(materials), strings.Join(available, ", "))
+	}
+
+	for _, m := range materials {
+		if strings.EqualFold(m.Name, name) {
+			return m, nil
+		}
+	}
+	return material{}, fmt.Errorf("%s has no material named %s.  Materials: %s", pipeline, name, strings.Join(available, ", "))
+}
+
+func names(variables map[string]variable) string {
+	if len(variables) == 0 {
+		return "none"
+	}
+
+	sorted := []string{}
+	for name := range variables {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
@@ -0,0 +1,86 @@
+package gocd
+
+import (
+	"testing"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOptions(t *testing.T) {
+	config := &pipelineConfig{
+		Name: "api",
+		EnvironmentVariables: []variable{
+			{Name: "DEPLOY_ENV"},
+			{Name: "TOKEN", Secure: true},
+		},
+	}
+
+	history := []instance{{}}
+	history[0].BuildCause.MaterialRevisions = []materialRevision{
+		{Material: material{Name: "upstream", Type: "Pipeline", Fingerprint: "f0"}},
+		{Material: material{Name: "api-repo", Type: "Git", Fingerprint: "f1"}},
+	}
+
+	Convey("Given a revision and variables", t, func() {
+		options, err := parseOptions("rev=abc123 env.DEPLOY_ENV=prod env.TOKEN=s3cret")
+		So(err, ShouldBeNil)
+
+		req, fields, err := options.scheduleRequest(config, history)
+		So(err, ShouldBeNil)
+
+		Convey("Then I expect them to be passed to the schedule api", func() {
+			So(req.Materials, ShouldResemble, []materialSelection{{Fingerprint: "f1", Revision: "abc123"}})
+			So(req.EnvironmentVariables, ShouldResemble, []variable{
+				{Name: "DEPLOY_ENV", Value: "prod"},
+				{Name: "TOKEN", Value: "s3cret", Secure: true},
+			})
+			So(req.UpdateMaterials, ShouldBeTrue)
+		})
+
+		Convey("Then I expect to echo what was scheduled with secure values masked", func() {
+			So(fields, ShouldResemble, []gobot.Field{
+				{Name: "env.DEPLOY_ENV", Value: "prod"},
+				{Name: "env.TOKEN", Value: masked},
+				{Name: "api-repo", Value: "abc123"},
+			})
+		})
+	})
+
+	Convey("Given a variable the pipeline doesn't define", t, func() {
+		options, _ := parseOptions("env.DEPLOY_ENV=prod env.NOPE=1")
+		_, _, err := options.scheduleRequest(config, history)
+
+		Convey("Then I expect it to be rejected", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "api doesn't define NOPE.  Defined variables: DEPLOY_ENV, TOKEN")
+		})
+	})
+
+	Convey("Given a revision for a named material", t, func() {
+		options, _ := parseOptions("rev.API-REPO=def456")
+		req, _, err := options.scheduleRequest(config, history)
+
+		Convey("Then I expect the material to be found regardless of case", func() {
+			So(err, ShouldBeNil)
+			So(req.Materials, ShouldResemble, []materialSelection{{Fingerprint: "f1", Revision: "def456"}})
+		})
+	})
+
+	Convey("Given a revision for a pipeline that has never run", t, func() {
+		options, _ := parseOptions("rev=abc123")
+		_, _, err := options.scheduleRequest(config, nil)
+
+		Convey("Then I expect an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an unrecognized option", t, func() {
+		_, err := parseOptions("branch=main")
+
+		Convey("Then I expect an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,173 @@
+package gocd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+)
+
+// pauseCause records who paused the pipeline alongside why, since the Go server only knows the
+// bot's own user
+func pauseCause(user, reason string) string {
+	if reason == "" {
+		reason = "no reason given"
+	}
+	return fmt.Sprintf("%s (paused by %s)", reason, user)
+}
+
+// resolveTargets expands target into the names of the pipelines it refers to.  target may be:
+//
+//	<pipeline>          a single pipeline
+//	group:<group>       every pipeline in the group
+//	<glob>              every pipeline matching the glob e.g. payments-*
+func resolveTargets(d *dashboard, target string) ([]string, error) {
+	names := []string{}
+
+	switch {
+	case strings.HasPrefix(target, "group:"):
+		group := strings.TrimPrefix(target, "group:")
+		for _, g := range d.Embedded.Groups {
+			if strings.EqualFold(g.Name, group) {
+				names = append(names, g.Pipelines...)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("Unable to find a pipeline group with name, %s", group)
+		}
+
+	case strings.ContainsAny(target, "*?["):
+		for _, p := range d.Embedded.Pipelines {
+			matched, err := path.Match(target, p.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern, %s => %s", target, err.Error())
+			}
+			if matched {
+				names = append(names, p.Name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("No pipelines match %s", target)
+		}
+
+	default:
+		for _, p := range d.Embedded.Pipelines {
+			if p.Name == target {
+				return []string{p.Name}, nil
+			}
+		}
+		return nil, fmt.Errorf("Unable to find a pipeline with name, %s", target)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// eachTarget applies fn to every pipeline the target param refers to, recording each in the audit
+// log.  The response lists the outcome for each pipeline.  If confirmMany is set, the user must
+// confirm the list of pipelines first when there's more than one.
+func (r *receiver) eachTarget(c *gobot.Context, action, done string, confirmMany bool, fn func(pipeline string) error) {
+	log.WithField("provider", "gocd").Debugf("#%s", action)
+
+	d, err := r.client.dashboard(c)
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	target := c.String("target")
+	pipelines, err := resolveTargets(d, target)
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	if confirmMany && len(pipelines) > 1 {
+		prompt := fmt.Sprintf("About to %s %d pipelines matching %s: %s", action, len(pipelines), target, strings.Join(pipelines, ", "))
+		if err := c.Confirm(prompt); err != nil {
+			c.Fail(err)
+			return
+		}
+	}
+
+	section := gobot.Section{Status: gobot.StatusGood}
+	failed := 0
+	for _, pipeline := range pipelines {
+		err := fn(pipeline)
+		r.audit.record(c, action, pipeline, err)
+
+		field := gobot.Field{Name: pipeline, Value: done, Status: gobot.StatusGood}
+		if err != nil {
+			failed++
+			field.Value, field.Status = err.Error(), gobot.StatusDanger
+		}
+		section.Fields = append(section.Fields, field)
+	}
+
+	section.Text = fmt.Sprintf("%s %d of %d pipelines matching %s", strings.Title(done), len(pipelines)-failed, len(pipelines), target)
+	if failed > 0 {
+		section.Status = gobot.StatusDanger
+	}
+	c.Respond("").Add(section)
+}
+
+func (r *receiver) pause(c *gobot.Context) {
+	cause := pauseCause(c.User, c.String("reason"))
+	// pausing a single pipeline stays quick; a group or glob may catch more than intended
+	r.eachTarget(c, "pause", "paused", true, func(pipeline string) error {
+		return r.client.pause(c, pipeline, cause)
+	})
+}
+
+func (r *receiver) unpause(c *gobot.Context) {
+	r.eachTarget(c, "unpause", "unpaused", false, func(pipeline string) error {
+		return r.client.unpause(c, pipeline)
+	})
+}
+
+func (r *receiver) unlock(c *gobot.Context) {
+	r.eachTarget(c, "unlock", "unlocked", false, func(pipeline string) error {
+		return r.client.unlock(c, pipeline)
+	})
+}
+
+func (r *receiver) listPaused(c *gobot.Context) {
+	log.WithField("provider", "gocd").Debugf("#listPaused")
+
+	d, err := r.client.dashboard(c)
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	paused := gobot.Section{Text: "Paused pipelines:", Status: gobot.StatusWarning}
+	locked := gobot.Section{Text: "Locked pipelines:", Status: gobot.StatusWarning}
+	for _, p := range d.Embedded.Pipelines {
+		if p.PauseInfo.Paused {
+			value := p.PauseInfo.PauseReason
+			if p.PauseInfo.PausedBy != "" {
+				value = value + " [" + p.PauseInfo.PausedBy + "]"
+			}
+			paused.Fields = append(paused.Fields, gobot.Field{Name: p.Name, Value: strings.TrimSpace(value)})
+		}
+		if p.Locked {
+			locked.Fields = append(locked.Fields, gobot.Field{Name: p.Name, Value: "locked"})
+		}
+	}
+
+	if len(paused.Fields) == 0 && len(locked.Fields) == 0 {
+		c.Respond("").Add(gobot.Section{Text: "No pipelines are paused or locked", Status: gobot.StatusGood})
+		return
+	}
+
+	response := c.Respond("")
+	if len(paused.Fields) > 0 {
+		response.Add(paused)
+	}
+	if len(locked.Fields) > 0 {
+		response.Add(locked)
+	}
+}
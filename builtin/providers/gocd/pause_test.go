@@ -0,0 +1,167 @@
+package gocd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolveTargets(t *testing.T) {
+	d := &dashboard{}
+	d.Embedded.Groups = []dashboardGroup{
+		{Name: "payments", Pipelines: []string{"payments-api", "ledger"}},
+		{Name: "web", Pipelines: []string{"web"}},
+	}
+	d.Embedded.Pipelines = []dashboardPipeline{
+		{Name: "payments-api"},
+		{Name: "ledger"},
+		{Name: "web"},
+		{Name: "payments-worker"},
+	}
+
+	Convey("Given a pipeline", t, func() {
+		names, err := resolveTargets(d, "web")
+
+		Convey("Then only that pipeline is returned", func() {
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"web"})
+		})
+	})
+
+	Convey("Given a group", t, func() {
+		names, err := resolveTargets(d, "group:Payments")
+
+		Convey("Then each of its pipelines is returned, sorted", func() {
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"ledger", "payments-api"})
+		})
+	})
+
+	Convey("Given a glob", t, func() {
+		names, err := resolveTargets(d, "payments-*")
+
+		Convey("Then every matching pipeline is returned", func() {
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"payments-api", "payments-worker"})
+		})
+	})
+
+	Convey("Given targets that match nothing", t, func() {
+		Convey("Then each is an error", func() {
+			for _, target := range []string{"nope", "group:nope", "nope-*", "[invalid"} {
+				_, err := resolveTargets(d, target)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestPause(t *testing.T) {
+	Convey("Given a reason", t, func() {
+		Convey("Then the cause records who paused the pipeline", func() {
+			So(pauseCause("matt", "incident 42"), ShouldEqual, "incident 42 (paused by matt)")
+			So(pauseCause("matt", ""), ShouldEqual, "no reason given (paused by matt)")
+		})
+	})
+
+	Convey("Given a Go server", t, func() {
+		var path, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			data, _ := ioutil.ReadAll(req.Body)
+			path, body = req.URL.Path, string(data)
+		}))
+		defer server.Close()
+
+		c := &client{codebase: server.URL, http: http.DefaultClient}
+
+		Convey("When a pipeline is paused", func() {
+			err := c.pause(context.Background(), "api", "incident 42 (paused by matt)")
+
+			Convey("Then the cause is sent", func() {
+				So(err, ShouldBeNil)
+				So(path, ShouldEqual, "/go/api/pipelines/api/pause")
+				So(body, ShouldEqual, `{"pause_cause":"incident 42 (paused by matt)"}`)
+			})
+		})
+	})
+}
+
+func TestPauseConfirmation(t *testing.T) {
+	Convey("Given a Go server with several payments pipelines", t, func() {
+		mutex := &sync.Mutex{}
+		paused := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/go/api/dashboard":
+				d := dashboard{}
+				d.Embedded.Pipelines = []dashboardPipeline{{Name: "payments-api"}, {Name: "payments-worker"}, {Name: "web"}}
+				json.NewEncoder(w).Encode(d)
+			default:
+				mutex.Lock()
+				paused = append(paused, req.URL.Path)
+				mutex.Unlock()
+			}
+		}))
+		defer server.Close()
+
+		r := &receiver{client: &client{codebase: server.URL, http: http.DefaultClient}}
+		conversations := gobot.Converse(gobot.Handlers{}.WithCommands(&gobot.Command{
+			Grammar: "go pause <target> [<reason:text>]",
+			Action:  r.pause,
+		}))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		prompts := make(chan string, 1)
+		sender := gobot.SenderFunc(func(response *gobot.Response) error {
+			prompts <- response.Text
+			return nil
+		})
+		pause := func(text string) chan *gobot.Response {
+			responses := make(chan *gobot.Response, 1)
+			go func() {
+				response, _ := conversations.OnMessage(&gobot.Context{Context: context.Background(), User: "matt", Channel: "ops", Text: text, Sender: sender})
+				responses <- response
+			}()
+			return responses
+		}
+		pausedPaths := func() []string {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]string{}, paused...)
+		}
+
+		Convey("When a single pipeline is paused", func() {
+			response := <-pause("go pause web")
+
+			Convey("Then it's paused without confirmation", func() {
+				So(response.Blocks[0].(gobot.Section).Text, ShouldEqual, "Paused 1 of 1 pipelines matching web")
+				So(pausedPaths(), ShouldResemble, []string{"/go/api/pipelines/web/pause"})
+				So(prompts, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a glob is paused", func() {
+			responses := pause("go pause payments-* incident 42")
+			So(<-prompts, ShouldStartWith, "About to pause 2 pipelines matching payments-*: payments-api, payments-worker - reply `yes`")
+
+			Convey("Then nothing is paused if the user declines", func() {
+				So(conversations.Answer(&gobot.Context{User: "matt", Channel: "ops", Text: "no"}), ShouldBeTrue)
+				So((<-responses).Text, ShouldEqual, "Cancelled, `go pause payments-* incident 42`")
+				So(pausedPaths(), ShouldBeEmpty)
+			})
+
+			Convey("Then each pipeline is paused once the user confirms", func() {
+				So(conversations.Answer(&gobot.Context{User: "matt", Channel: "ops", Text: "yes"}), ShouldBeTrue)
+				So((<-responses).Blocks[0].(gobot.Section).Text, ShouldEqual, "Paused 2 of 2 pipelines matching payments-*")
+				So(pausedPaths(), ShouldResemble, []string{"/go/api/pipelines/payments-api/pause", "/go/api/pipelines/payments-worker/pause"})
+			})
+		})
+	})
+}
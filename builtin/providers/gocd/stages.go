@@ -0,0 +1,140 @@
+package gocd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+)
+
+// run identifies a stage of a pipeline run e.g. api/12/deploy or, with the stage counter,
+// api/12/deploy/2
+type run struct {
+	pipeline     string
+	counter      int
+	stage        string
+	stageCounter string
+}
+
+func (r run) String() string {
+	s := fmt.Sprintf("%s/%d/%s", r.pipeline, r.counter, r.stage)
+	if r.stageCounter != "" {
+		s = s + "/" + r.stageCounter
+	}
+	return s
+}
+
+func parseRun(text string) (run, error) {
+	segments := strings.Split(text, "/")
+	if len(segments) != 3 && len(segments) != 4 {
+		return run{}, fmt.Errorf("invalid stage, %s; expected <pipeline>/<counter>/<stage>", text)
+	}
+
+	counter, err := strconv.Atoi(segments[1])
+	if err != nil || counter < 1 || segments[0] == "" || segments[2] == "" {
+		return run{}, fmt.Errorf("invalid stage, %s; expected <pipeline>/<counter>/<stage>", text)
+	}
+
+	r := run{pipeline: segments[0], counter: counter, stage: segments[2]}
+	if len(segments) == 4 {
+		if n, err := strconv.Atoi(segments[3]); err != nil || n < 1 {
+			return run{}, fmt.Errorf("invalid stage counter, %s", segments[3])
+		}
+		r.stageCounter = segments[3]
+	}
+	return r, nil
+}
+
+// findStage returns the stage of the pipeline run, which must exist
+func (r *receiver) findStage(c *gobot.Context, target run) (stage, error) {
+	inst, err := r.client.instance(c, target.pipeline, target.counter)
+	if err != nil {
+		return stage{}, err
+	}
+
+	available := []string{}
+	for _, s := range inst.Stages {
+		if s.Name == target.stage {
+			return s, nil
+		}
+		available = append(available, s.Name)
+	}
+	return stage{}, fmt.Errorf("%s/%d has no stage named %s.  Stages: %s", target.pipeline, target.counter, target.stage, strings.Join(available, ", "))
+}
+
+// stageAction runs fn against the stage identified by the run param, recording the outcome in the
+// audit log and reporting it to the user
+func (r *receiver) stageAction(c *gobot.Context, action string, fn func(target run, s stage) (string, error)) {
+	log.WithField("provider", "gocd").Debugf("#%s", action)
+
+	target, err := parseRun(c.String("run"))
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+
+	s, err := r.findStage(c, target)
+	if err == nil {
+		if target.stageCounter == "" {
+			target.stageCounter = s.Counter
+		}
+		var text string
+		if text, err = fn(target, s); err == nil {
+			r.audit.record(c, action, target.String(), nil)
+
+			section := gobot.Section{Text: text, Status: gobot.StatusGood}
+			c.Respond("").Add(section, gobot.Buttons{{Text: "Open in GoCD", URL: r.client.link(target.pipeline, target.counter)}})
+			return
+		}
+	}
+
+	r.audit.record(c, action, target.String(), err)
+	c.Fail(err)
+}
+
+func (r *receiver) approve(c *gobot.Context) {
+	r.stageAction(c, "approve", func(target run, s stage) (string, error) {
+		if s.Scheduled {
+			return "", fmt.Errorf("%s has already run; use go rerun to run its failed jobs again", target)
+		}
+
+		if err := r.client.runStage(c, target.pipeline, target.counter, target.stage); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Approved stage %s of %s/%d", target.stage, target.pipeline, target.counter), nil
+	})
+}
+
+func (r *receiver) cancel(c *gobot.Context) {
+	r.stageAction(c, "cancel", func(target run, s stage) (string, error) {
+		if !s.Scheduled || completed(s.Result) {
+			return "", fmt.Errorf("%s isn't running", target)
+		}
+
+		if err := r.client.cancelStage(c, target.pipeline, target.counter, target.stage, target.stageCounter); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Cancelled stage %s of %s/%d", target.stage, target.pipeline, target.counter), nil
+	})
+}
+
+func (r *receiver) rerun(c *gobot.Context) {
+	r.stageAction(c, "rerun", func(target run, s stage) (string, error) {
+		failed := []string{}
+		for _, j := range s.Jobs {
+			if j.Result == "Failed" {
+				failed = append(failed, j.Name)
+			}
+		}
+		if len(failed) == 0 {
+			return "", fmt.Errorf("%s has no failed jobs to rerun", target)
+		}
+
+		if err := r.client.rerunFailedJobs(c, target.pipeline, target.counter, target.stage, target.stageCounter); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Rerunning failed jobs of stage %s of %s/%d: %s", target.stage, target.pipeline, target.counter, strings.Join(failed, ", ")), nil
+	})
+}
@@ -0,0 +1,133 @@
+package gocd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseRun(t *testing.T) {
+	Convey("Given a pipeline, counter, and stage", t, func() {
+		r, err := parseRun("api/12/deploy")
+
+		Convey("Then each part is parsed", func() {
+			So(err, ShouldBeNil)
+			So(r, ShouldResemble, run{pipeline: "api", counter: 12, stage: "deploy"})
+			So(r.String(), ShouldEqual, "api/12/deploy")
+		})
+	})
+
+	Convey("Given a stage counter", t, func() {
+		r, err := parseRun("api/12/deploy/2")
+
+		Convey("Then it's kept", func() {
+			So(err, ShouldBeNil)
+			So(r.stageCounter, ShouldEqual, "2")
+			So(r.String(), ShouldEqual, "api/12/deploy/2")
+		})
+	})
+
+	Convey("Given malformed stages", t, func() {
+		Convey("Then each is rejected", func() {
+			for _, text := range []string{"api", "api/12", "api/latest/deploy", "api/12/deploy/x", "/12/deploy", "api/0/deploy"} {
+				_, err := parseRun(text)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestStageClient(t *testing.T) {
+	Convey("Given a Go server", t, func() {
+		requests := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req.Method+" "+req.URL.Path+" "+req.Header.Get("X-GoCD-Confirm"))
+			if strings.Contains(req.URL.Path, "/test/") {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"message":"Stage is not running"}`))
+				return
+			}
+			w.Write([]byte(`{"message":"accepted"}`))
+		}))
+		defer server.Close()
+
+		c := &client{codebase: server.URL, http: http.DefaultClient}
+		ctx := context.Background()
+
+		Convey("When stages are approved, cancelled, and rerun", func() {
+			So(c.runStage(ctx, "api", 12, "deploy"), ShouldBeNil)
+			So(c.cancelStage(ctx, "api", 12, "build", "1"), ShouldBeNil)
+			So(c.rerunFailedJobs(ctx, "api", 12, "build", "2"), ShouldBeNil)
+
+			Convey("Then each is confirmed and sent to its endpoint", func() {
+				So(requests, ShouldResemble, []string{
+					"POST /go/api/stages/api/12/deploy/run true",
+					"POST /go/api/stages/api/12/build/1/cancel true",
+					"POST /go/api/stages/api/12/build/2/run-failed-jobs true",
+				})
+			})
+		})
+
+		Convey("When the Go server refuses", func() {
+			err := c.cancelStage(ctx, "api", 12, "test", "1")
+
+			Convey("Then its message is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Go server returned 409 => Stage is not running")
+			})
+		})
+	})
+}
+
+func TestAuditor(t *testing.T) {
+	Convey("Given an audit file", t, func() {
+		dir, err := ioutil.TempDir("", "gocd-audit")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		a := &auditor{path: filepath.Join(dir, "audit.log")}
+		c := &gobot.Context{User: "matt", Channel: "ops", ConfirmedBy: "joe"}
+
+		Convey("When actions are recorded", func() {
+			a.record(c, "approve", "api/12/deploy/1", nil)
+			a.record(c, "cancel", "api/12/test/1", errors.New("boom"))
+
+			Convey("Then each is appended as a json line", func() {
+				data, err := ioutil.ReadFile(a.path)
+				So(err, ShouldBeNil)
+
+				lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+				So(lines, ShouldHaveLength, 2)
+
+				entry := auditEntry{}
+				So(json.Unmarshal([]byte(lines[0]), &entry), ShouldBeNil)
+				So(entry.User, ShouldEqual, "matt")
+				So(entry.ConfirmedBy, ShouldEqual, "joe")
+				So(entry.Action, ShouldEqual, "approve")
+				So(entry.Target, ShouldEqual, "api/12/deploy/1")
+				So(entry.Error, ShouldEqual, "")
+
+				So(json.Unmarshal([]byte(lines[1]), &entry), ShouldBeNil)
+				So(entry.Error, ShouldEqual, "boom")
+			})
+		})
+	})
+
+	Convey("Given no audit file", t, func() {
+		var a *auditor
+
+		Convey("Then recording is still safe", func() {
+			So(func() { a.record(&gobot.Context{}, "build", "api", nil) }, ShouldNotPanic)
+		})
+	})
+}
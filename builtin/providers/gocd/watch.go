@@ -0,0 +1,281 @@
+package gocd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/savaki/gobot"
+)
+
+const (
+	// PollInterval is how often a watched run is checked for progress
+	PollInterval = 10 * time.Second
+
+	// MaxPollInterval bounds the backoff while the Go server is slow or unavailable
+	MaxPollInterval = time.Minute
+
+	// FindTimeout is how long to wait for a scheduled run to appear in the pipeline's history
+	FindTimeout = 5 * time.Minute
+
+	// MaxPollFailures is how many consecutive failed polls are tolerated before giving up
+	MaxPollFailures = 10
+)
+
+// watcher follows a single run of a pipeline, reporting each job and stage as it completes
+type watcher struct {
+	client   *client
+	pipeline string
+	poll     time.Duration
+	started  time.Time
+	reported map[string]bool
+
+	// approver and revisions identify the run we scheduled among any others
+	approver    string
+	revisions   []materialSelection
+	findTimeout time.Duration
+}
+
+func (r *receiver) newWatcher(pipeline string, started time.Time, revisions []materialSelection) *watcher {
+	poll := r.poll
+	if poll <= 0 {
+		poll = PollInterval
+	}
+
+	return &watcher{
+		client:      r.client,
+		pipeline:    pipeline,
+		poll:        poll,
+		started:     started,
+		reported:    map[string]bool{},
+		approver:    r.client.username,
+		revisions:   revisions,
+		findTimeout: FindTimeout,
+	}
+}
+
+// watch finds the run scheduled after previous and reports its progress until it finishes.  It's
+// intended to be run via gobot.Context#Go, so the summary is its response.
+func (w *watcher) watch(c *gobot.Context, previous int) {
+	counter, err := w.find(c, previous)
+	if err != nil {
+		c.Respond(fmt.Sprintf("Stopped watching %s => %s", w.pipeline, err.Error()))
+		return
+	}
+
+	name := fmt.Sprintf("%s/%d", w.pipeline, counter)
+	link := w.client.link(w.pipeline, counter)
+	c.Say(fmt.Sprintf("Watching %s", name))
+
+	failures := 0
+	delay := w.poll
+	for {
+		if !sleep(c, delay) {
+			c.Respond(fmt.Sprintf("Stopped watching %s because I'm shutting down.  Follow it at %s", name, link))
+			return
+		}
+
+		inst, err := w.instance(c, counter)
+		if err != nil {
+			if c.Err() != nil {
+				continue // reported by sleep on the next pass
+			}
+
+			failures++
+			log.WithField("provider", "gocd").Warnf("unable to check on %s (%d/%d) => %s", name, failures, MaxPollFailures, err.Error())
+			if failures >= MaxPollFailures {
+				c.Respond(fmt.Sprintf("Lost track of %s; the Go server isn't responding.  Follow it at %s", name, link))
+				return
+			}
+
+			// back off while the server is struggling
+			if delay *= 2; delay > MaxPollInterval {
+				delay = MaxPollInterval
+			}
+			continue
+		}
+		failures, delay = 0, w.poll
+
+		w.report(c, inst)
+
+		if done, result, waiting := finished(inst); done {
+			elapsed := time.Now().Sub(w.started) / time.Second * time.Second
+
+			text := fmt.Sprintf("%s %s in %v", name, lower(result), elapsed)
+			buttons := gobot.Buttons{{Text: "Open in GoCD", URL: link}}
+			if waiting != "" {
+				text = fmt.Sprintf("%s is waiting for stage %s to be approved, after %v", name, waiting, elapsed)
+				buttons = append(buttons, gobot.Button{Text: "Approve " + waiting, Value: "go approve " + name + "/" + waiting})
+			}
+			c.Respond("").Add(gobot.Section{Text: text, Status: statusOfResult(result)}, buttons)
+			return
+		}
+	}
+}
+
+// find polls the pipeline's history until a run newer than previous appears
+func (w *watcher) find(c *gobot.Context, previous int) (int, error) {
+	deadline := time.Now().Add(w.findTimeout)
+
+	for time.Now().Before(deadline) {
+		ctx, cancel := context.WithTimeout(c, DefaultTimeout)
+		history, err := w.client.history(ctx, w.pipeline)
+		cancel()
+
+		if err != nil {
+			log.WithField("provider", "gocd").Warnf("unable to find the new run of %s => %s", w.pipeline, err.Error())
+		}
+
+		// other runs may have started since ours; only watch one we can be sure is ours
+		candidates := []string{}
+		counter := 0
+		for _, inst := range history {
+			if inst.Counter > previous && w.ours(inst) {
+				candidates = append(candidates, fmt.Sprintf("%s/%d", w.pipeline, inst.Counter))
+				counter = inst.Counter
+			}
+		}
+		switch {
+		case len(candidates) == 1:
+			return counter, nil
+		case len(candidates) > 1:
+			return 0, fmt.Errorf("couldn't identify the run I scheduled; it's one of %s", strings.Join(candidates, ", "))
+		}
+
+		if !sleep(c, w.poll) {
+			return 0, c.Err()
+		}
+	}
+
+	return 0, fmt.Errorf("couldn't identify the run I scheduled within %v", w.findTimeout)
+}
+
+// ours returns true if the run could be the one we scheduled: forced, by our Go user when we know
+// it, using each revision we asked for.  Revisions may be abbreviated.
+func (w *watcher) ours(inst instance) bool {
+	cause := inst.BuildCause
+	if !cause.TriggerForced {
+		return false
+	}
+	if w.approver != "" && cause.Approver != w.approver {
+		return false
+	}
+
+	for _, want := range w.revisions {
+		found := false
+		for _, mr := range cause.MaterialRevisions {
+			if mr.Material.Fingerprint == want.Fingerprint && len(mr.Modifications) > 0 && strings.HasPrefix(mr.Modifications[0].Revision, want.Revision) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *watcher) instance(c *gobot.Context, counter int) (*instance, error) {
+	ctx, cancel := context.WithTimeout(c, DefaultTimeout)
+	defer cancel()
+
+	return w.client.instance(ctx, w.pipeline, counter)
+}
+
+// report says each job and stage that has completed since the last report
+func (w *watcher) report(c *gobot.Context, inst *instance) {
+	for _, s := range inst.Stages {
+		if !s.Scheduled {
+			continue
+		}
+
+		for _, j := range s.Jobs {
+			key := s.Name + "/" + j.Name
+			if !completed(j.Result) || w.reported[key] {
+				continue
+			}
+			w.reported[key] = true
+			c.Say(statusOfResult(j.Result).Symbol() + fmt.Sprintf(" job %s %s", key, lower(j.Result)))
+		}
+
+		if !completed(s.Result) || w.reported[s.Name] {
+			continue
+		}
+		w.reported[s.Name] = true
+		c.Say(statusOfResult(s.Result).Symbol() + fmt.Sprintf(" stage %s %s", s.Name, lower(s.Result)))
+	}
+}
+
+// finished returns true once no more stages will run without someone's intervention, along with
+// the result and, if the next stage requires approval, its name
+func finished(inst *instance) (done bool, result, waiting string) {
+	last := -1
+	for i, s := range inst.Stages {
+		if !s.Scheduled {
+			continue
+		}
+		if !completed(s.Result) {
+			return false, "", ""
+		}
+		last = i
+	}
+	if last == -1 {
+		return false, "", ""
+	}
+
+	result = inst.Stages[last].Result
+	switch {
+	case result != "Passed":
+		return true, result, ""
+	case last == len(inst.Stages)-1:
+		return true, result, ""
+	case inst.Stages[last+1].ApprovalType == "manual":
+		return true, result, inst.Stages[last+1].Name
+	default:
+		// the next stage will be scheduled automatically
+		return false, "", ""
+	}
+}
+
+// completed returns true for the results of stages and jobs that are no longer running
+func completed(result string) bool {
+	return result == "Passed" || result == "Failed" || result == "Cancelled"
+}
+
+func statusOfResult(result string) gobot.Status {
+	switch result {
+	case "Passed":
+		return gobot.StatusGood
+	case "Failed":
+		return gobot.StatusDanger
+	default:
+		return gobot.StatusWarning
+	}
+}
+
+func lower(result string) string {
+	switch result {
+	case "Passed":
+		return "passed"
+	case "Failed":
+		return "failed"
+	case "Cancelled":
+		return "was cancelled"
+	default:
+		return result
+	}
+}
+
+// sleep waits for d, returning false if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,294 @@
+package gocd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeServer serves the history and instance endpoints, advancing the run by one step on each
+// poll of the instance.  The history shows runs once checked; by default just the run scheduled by gobot.
+type fakeServer struct {
+	mutex sync.Mutex
+	found bool
+	runs  []instance
+	steps []instance
+	fails int
+}
+
+func forced(counter int, approver string) instance {
+	inst := instance{Name: "api", Counter: counter}
+	inst.BuildCause.TriggerForced = true
+	inst.BuildCause.Approver = approver
+	return inst
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.fails > 0 {
+		f.fails--
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch req.URL.Path {
+	case "/go/api/pipelines/api/history":
+		// new runs only appear on the second check
+		runs := []instance{forced(7, "gobot")}
+		if f.found {
+			runs = f.runs
+			if runs == nil {
+				runs = []instance{forced(8, "gobot"), forced(7, "gobot")}
+			}
+		}
+		f.found = true
+		json.NewEncoder(w).Encode(map[string]interface{}{"pipelines": runs})
+
+	case "/go/api/pipelines/api/8":
+		step := f.steps[0]
+		if len(f.steps) > 1 {
+			f.steps = f.steps[1:]
+		}
+		json.NewEncoder(w).Encode(step)
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func newStage(name, result, approval string, scheduled bool, jobs ...job) stage {
+	return stage{Name: name, Result: result, ApprovalType: approval, Scheduled: scheduled, Jobs: jobs}
+}
+
+func watchWith(ctx context.Context, server *fakeServer) []*gobot.Response {
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	r := &receiver{client: &client{codebase: s.URL, username: "gobot", http: http.DefaultClient}, poll: time.Millisecond}
+	w := r.newWatcher("api", time.Now(), nil)
+	w.findTimeout = 50 * time.Millisecond
+
+	mutex := &sync.Mutex{}
+	responses := []*gobot.Response{}
+	done := make(chan struct{})
+
+	c := &gobot.Context{
+		Context: ctx,
+		Sender: gobot.SenderFunc(func(response *gobot.Response) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			responses = append(responses, response)
+			return nil
+		}),
+	}
+	c.Go(func(c *gobot.Context) {
+		defer close(done)
+		w.watch(c, 7)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+	}
+	time.Sleep(10 * time.Millisecond) // the summary is sent once watch returns
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return responses
+}
+
+func texts(responses []*gobot.Response) []string {
+	result := []string{}
+	for _, r := range responses {
+		result = append(result, r.Text)
+	}
+	return result
+}
+
+func TestWatch(t *testing.T) {
+	Convey("Given a run that passes its first stage and fails its second", t, func() {
+		server := &fakeServer{
+			fails: 2, // a struggling server shouldn't stop the watch
+			steps: []instance{
+				{Stages: []stage{
+					newStage("build", "Unknown", "success", true, job{Name: "compile", Result: "Unknown"}),
+					newStage("test", "Unknown", "success", false),
+				}},
+				{Stages: []stage{
+					newStage("build", "Passed", "success", true, job{Name: "compile", Result: "Passed"}),
+					newStage("test", "Unknown", "success", false),
+				}},
+				{Stages: []stage{
+					newStage("build", "Passed", "success", true, job{Name: "compile", Result: "Passed"}),
+					newStage("test", "Failed", "success", true, job{Name: "unit", Result: "Failed"}, job{Name: "lint", Result: "Passed"}),
+				}},
+			},
+		}
+
+		responses := watchWith(context.Background(), server)
+
+		Convey("Then each job and stage is reported once, followed by a summary", func() {
+			So(responses, ShouldHaveLength, 7)
+			So(texts(responses[:6]), ShouldResemble, []string{
+				"Watching api/8",
+				"🟢 job build/compile passed",
+				"🟢 stage build passed",
+				"🔴 job test/unit failed",
+				"🟢 job test/lint passed",
+				"🔴 stage test failed",
+			})
+
+			summary := responses[6]
+			So(summary.Text, ShouldStartWith, "🔴 api/8 failed in 0s")
+			So(summary.Blocks, ShouldHaveLength, 2)
+			So(summary.Blocks[1].(gobot.Buttons)[0].URL, ShouldEndWith, "/go/pipelines/value_stream_map/api/8")
+		})
+	})
+
+	Convey("Given a run whose next stage requires approval", t, func() {
+		server := &fakeServer{
+			steps: []instance{
+				{Stages: []stage{
+					newStage("build", "Passed", "success", true),
+					newStage("deploy", "Unknown", "manual", false),
+				}},
+			},
+		}
+
+		responses := watchWith(context.Background(), server)
+
+		Convey("Then the watch ends, waiting on the approval", func() {
+			last := texts(responses)[len(responses)-1]
+			So(last, ShouldStartWith, "🟢 api/8 is waiting for stage deploy to be approved, after 0s")
+
+			summary := responses[len(responses)-1]
+			So(summary.Blocks[1].(gobot.Buttons)[1].Value, ShouldEqual, "go approve api/8/deploy")
+		})
+	})
+
+	Convey("Given the bot shuts down during a run", t, func() {
+		server := &fakeServer{
+			steps: []instance{
+				{Stages: []stage{newStage("build", "Unknown", "success", true)}},
+			},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		responses := watchWith(ctx, server)
+
+		Convey("Then the watch stops with a link to the run", func() {
+			last := texts(responses)[len(responses)-1]
+			So(last, ShouldStartWith, "Stopped watching api/8 because I'm shutting down")
+			So(last, ShouldEndWith, "/go/pipelines/value_stream_map/api/8")
+		})
+	})
+}
+
+func TestFind(t *testing.T) {
+	Convey("Given other runs start alongside ours", t, func() {
+		server := &fakeServer{
+			runs: []instance{
+				{Name: "api", Counter: 10}, // triggered by a material change
+				forced(9, "alice"),
+				forced(8, "gobot"),
+			},
+			steps: []instance{{Stages: []stage{newStage("build", "Passed", "success", true)}}},
+		}
+
+		responses := watchWith(context.Background(), server)
+
+		Convey("Then only the run forced by our user is watched", func() {
+			So(texts(responses)[0], ShouldEqual, "Watching api/8")
+		})
+	})
+
+	Convey("Given two runs that could be ours", t, func() {
+		server := &fakeServer{runs: []instance{forced(9, "gobot"), forced(8, "gobot")}}
+
+		responses := watchWith(context.Background(), server)
+
+		Convey("Then the user is told which runs it could be", func() {
+			So(texts(responses), ShouldResemble, []string{
+				"Stopped watching api => couldn't identify the run I scheduled; it's one of api/9, api/8",
+			})
+		})
+	})
+
+	Convey("Given our run never appears", t, func() {
+		server := &fakeServer{runs: []instance{forced(8, "alice")}}
+
+		responses := watchWith(context.Background(), server)
+
+		Convey("Then the user is told it couldn't be identified", func() {
+			So(texts(responses), ShouldResemble, []string{
+				"Stopped watching api => couldn't identify the run I scheduled within 50ms",
+			})
+		})
+	})
+
+	Convey("Given we asked for a revision", t, func() {
+		w := &watcher{approver: "gobot", revisions: []materialSelection{{Fingerprint: "f1", Revision: "0123abc"}}}
+
+		run := func(revision string) instance {
+			inst := forced(8, "gobot")
+			inst.BuildCause.MaterialRevisions = []materialRevision{{
+				Material:      material{Fingerprint: "f1"},
+				Modifications: []modification{{Revision: revision}},
+			}}
+			return inst
+		}
+
+		Convey("Then only a run of that revision is ours", func() {
+			So(w.ours(run("0123abcdef")), ShouldBeTrue)
+			So(w.ours(run("fedcba9876")), ShouldBeFalse)
+			So(w.ours(forced(8, "gobot")), ShouldBeFalse)
+		})
+	})
+}
+
+func TestFinished(t *testing.T) {
+	Convey("Given a run with a stage still building", t, func() {
+		inst := &instance{Stages: []stage{newStage("build", "Unknown", "success", true)}}
+
+		Convey("Then it's not finished", func() {
+			done, _, _ := finished(inst)
+			So(done, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a run whose next stage is scheduled automatically", t, func() {
+		inst := &instance{Stages: []stage{
+			newStage("build", "Passed", "success", true),
+			newStage("test", "Unknown", "success", false),
+		}}
+
+		Convey("Then it's not finished", func() {
+			done, _, _ := finished(inst)
+			So(done, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a run that was cancelled", t, func() {
+		inst := &instance{Stages: []stage{
+			newStage("build", "Cancelled", "success", true),
+			newStage("test", "Unknown", "success", false),
+		}}
+
+		Convey("Then it's finished with the cancelled result", func() {
+			done, result, waiting := finished(inst)
+			So(done, ShouldBeTrue)
+			So(result, ShouldEqual, "Cancelled")
+			So(waiting, ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package mfa
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive lock on the file alongside Filename, waiting for any other process to
+// release it.  The lock isn't taken on Filename itself, which is replaced on every write.
+func (f *FileStore) lock() (func(), error) {
+	file, err := os.OpenFile(f.Filename+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,6 @@
+package mfa
+
+// lock is a no-op on windows, where FileStore is only safe within a single process
+func (f *FileStore) lock() (func(), error) {
+	return func() {}, nil
+}
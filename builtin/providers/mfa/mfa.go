@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/base32"
 	"fmt"
-	"sync"
+	"strconv"
+	"strings"
+	"time"
 
 	"crypto/rand"
 
@@ -14,27 +16,80 @@ import (
 	"github.com/savaki/gobot"
 )
 
-func Provider() *gobot.Provider {
+func Provider(store Store) *gobot.Provider {
+	r := &receiver{store: store}
 	return &gobot.Provider{
 		Name: "mfa",
 		Commands: []gobot.Command{
 			{
-				Grammar: "mfa register (google)",
+				Grammar: "mfa register [<provider>]",
 				Summary: "register a new mfa device using the specified provider",
-				Action:  registerMFA,
+				Action:  r.registerMFA,
 			},
 			{
-				Grammar: `mfa verify (\d+)`,
+				Grammar: "mfa verify <code:int>",
 				Summary: "verify a specific MFA code",
-				Action:  verify,
+				Action:  r.verify,
+			},
+			{
+				Grammar: "mfa devices",
+				Summary: "list your registered mfa devices",
+				Action:  r.listDevices,
+			},
+			{
+				Grammar: "mfa revoke <device>",
+				Summary: "revoke one of your registered mfa devices",
+				Action:  r.revoke,
 			},
 		},
 	}
 }
 
-func registerMFA(c *gobot.Context) {
+type receiver struct {
+	store Store
+}
+
+func (r *receiver) registerMFA(c *gobot.Context) {
 	log.Debugf("registering mfa")
-	c.Respond(fmt.Sprintf("registering a %s mfa", c.Match(1)))
+
+	// the qr code holds the secret, so it must not be posted where others can see it
+	if !c.Private {
+		c.Respond("Sorry, `mfa register` replies with your secret.  Send it to me in a direct message instead.")
+		return
+	}
+
+	// adding a device requires proof of an existing one, otherwise whoever takes over the chat
+	// account could enrol their own authenticator
+	devices, err := r.store.Devices(c.User)
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+	if len(devices) > 0 {
+		code, err := c.Ask("You already have an mfa device.  Enter a code from it to register another.")
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+		if err := Verifier(r.store).Verify(c.User, strings.TrimSpace(code)); err != nil {
+			c.Fail(fmt.Errorf("Unable to register a new device => %s", err.Error()))
+			return
+		}
+	}
+
+	provider := c.String("provider")
+	if provider == "" {
+		answer, err := c.Ask("Which type of device would you like to register?  Supported providers: google")
+		if err != nil {
+			c.Fail(err)
+			return
+		}
+		provider = strings.ToLower(strings.TrimSpace(answer))
+	}
+	if provider != "google" {
+		c.Respond(fmt.Sprintf("unsupported mfa provider, %s.  Supported providers: google", provider))
+		return
+	}
 
 	data := make([]byte, 10)
 	if n, err := rand.Read(data); err != nil {
@@ -46,7 +101,18 @@ func registerMFA(c *gobot.Context) {
 	}
 	secret := base32.StdEncoding.EncodeToString(data)
 
-	saveOtp(c.User, secret)
+	name := nextName(provider, devices)
+
+	err = r.store.Save(c.User, Device{
+		Name:    name,
+		Secret:  secret,
+		Created: time.Now(),
+	})
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+	c.Respond(fmt.Sprintf("registering a %s mfa device, %s", provider, name))
 
 	code, err := qr.Encode("otpauth://totp/Gobot?secret="+secret, qr.Q)
 	if err != nil {
@@ -62,42 +128,130 @@ func registerMFA(c *gobot.Context) {
 	})
 }
 
-func verify(c *gobot.Context) {
+// nextName names a device after its provider, numbered one past the highest existing number so
+// that a revoked device's name is never reused for a live one
+func nextName(provider string, devices []Device) string {
+	highest := 0
+	for _, d := range devices {
+		if !strings.HasPrefix(d.Name, provider+"-") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(d.Name, provider+"-")); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return fmt.Sprintf("%s-%d", provider, highest+1)
+}
+
+func (r *receiver) verify(c *gobot.Context) {
 	log.Debugf("verifying mfa code")
 
-	secret, err := loadOtp(c.User)
+	if err := Verifier(r.store).Verify(c.User, c.String("code")); err != nil {
+		c.Fail(err)
+		return
+	}
+
+	c.Respond("MFA code valid")
+}
+
+func (r *receiver) listDevices(c *gobot.Context) {
+	devices, err := r.store.Devices(c.User)
 	if err != nil {
 		c.Fail(err)
 		return
 	}
 
-	totp := &otp.TOTP{Secret: secret}
-	if code := c.Match(1); totp.Now().Verify(code) {
-		c.Respond("MFA code valid")
-	} else {
-		c.Respond(fmt.Sprintf("invalid MFA code, expected %s", totp.Get()))
+	if len(devices) == 0 {
+		c.Respond("You have no registered mfa devices")
+		return
+	}
+
+	response := c.Respond("MFA devices:")
+	for i, d := range devices {
+		response.Append(fmt.Sprintf(" %d. %s (registered %s)", i+1, d.Name, d.Created.Format("2006-01-02 15:04")))
 	}
 }
 
-var keys map[string]string = map[string]string{}
+// revoke requires a code from one of the devices being kept, or from the device itself if it's
+// the last, so whoever takes over the chat account can't clear the way to enrol their own
+func (r *receiver) revoke(c *gobot.Context) {
+	name := c.String("device")
 
-var mutex sync.Mutex
+	devices, err := r.store.Devices(c.User)
+	if err != nil {
+		c.Fail(err)
+		return
+	}
 
-func saveOtp(user string, secret string) {
-	mutex.Lock()
-	defer mutex.Unlock()
+	var revoked *Device
+	kept := []Device{}
+	for i, d := range devices {
+		if d.Name == name {
+			revoked = &devices[i]
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	if revoked == nil {
+		c.Fail(fmt.Errorf("Unable to find an mfa device with name, %s", name))
+		return
+	}
 
-	keys[user] = secret
+	question := fmt.Sprintf("Enter a code from one of your other devices to revoke %s.", name)
+	if len(kept) == 0 {
+		kept = []Device{*revoked}
+		question = fmt.Sprintf("%s is your last device.  Enter a code from it to revoke it.", name)
+	}
+	code, err := c.Ask(question)
+	if err != nil {
+		c.Fail(err)
+		return
+	}
+	if err := verifyDevices(kept, strings.TrimSpace(code)); err != nil {
+		c.Fail(fmt.Errorf("Unable to revoke %s => %s", name, err.Error()))
+		return
+	}
+
+	if err := r.store.Delete(c.User, name); err != nil {
+		c.Fail(err)
+		return
+	}
+
+	log.WithField("user", c.User).Infof("revoked mfa device, %s", name)
+	c.Respond(fmt.Sprintf("Revoked mfa device, %s", name))
+}
+
+// -------------------------------------------------------
+
+// Verifier returns a gobot.Verifier that checks codes against any of the user's registered devices
+func Verifier(store Store) gobot.Verifier {
+	return verifier{store: store}
+}
+
+type verifier struct {
+	store Store
 }
 
-func loadOtp(user string) (string, error) {
-	mutex.Lock()
-	defer mutex.Unlock()
+func (v verifier) Verify(user, code string) error {
+	devices, err := v.store.Devices(user)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("no mfa device registered for user, %s", user)
+	}
+
+	return verifyDevices(devices, code)
+}
 
-	secret, found := keys[user]
-	if !found {
-		return "", fmt.Errorf("no secret associated with user, %s", user)
+// verifyDevices returns nil if code is valid for any of devices
+func verifyDevices(devices []Device, code string) error {
+	for _, d := range devices {
+		totp := &otp.TOTP{Secret: d.Secret}
+		if totp.Now().Verify(code) {
+			return nil
+		}
 	}
 
-	return secret, nil
+	return fmt.Errorf("invalid MFA code")
 }
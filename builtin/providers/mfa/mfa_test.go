@@ -0,0 +1,143 @@
+package mfa
+
+import (
+	"testing"
+
+	"github.com/hgfischer/go-otp"
+	"github.com/savaki/gobot"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNextName(t *testing.T) {
+	Convey("Given no devices", t, func() {
+		Convey("Then I expect the first to be numbered 1", func() {
+			So(nextName("google", nil), ShouldEqual, "google-1")
+		})
+	})
+
+	Convey("Given a device was revoked", t, func() {
+		devices := []Device{{Name: "google-1"}, {Name: "google-3"}, {Name: "yubikey-7"}}
+
+		Convey("Then I expect the name after the highest to be used", func() {
+			So(nextName("google", devices), ShouldEqual, "google-4")
+		})
+	})
+}
+
+func TestRegister(t *testing.T) {
+	Convey("Given a user with a registered device", t, func() {
+		store := NewMemoryStore()
+		So(store.Save("matt", Device{Name: "google-1", Secret: "JBSWY3DPEHPK3PXP"}), ShouldBeNil)
+
+		conversations := gobot.Converse(gobot.Handlers{}.WithProvider(Provider(store)))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		questions := make(chan string, 1)
+		sender := gobot.SenderFunc(func(r *gobot.Response) error {
+			questions <- r.Text
+			return nil
+		})
+
+		responses := make(chan *gobot.Response, 1)
+		go func() {
+			resp, _ := conversations.OnMessage(&gobot.Context{User: "matt", Channel: "D1", Private: true, Text: "mfa register google", Sender: sender})
+			responses <- resp
+		}()
+		So(<-questions, ShouldEqual, "You already have an mfa device.  Enter a code from it to register another.")
+
+		Convey("When the code is wrong", func() {
+			So(conversations.Answer(&gobot.Context{User: "matt", Channel: "D1", Text: "000000"}), ShouldBeTrue)
+
+			Convey("Then I expect no device to be added", func() {
+				So((<-responses).Text, ShouldEqual, "Unable to register a new device => invalid MFA code")
+
+				devices, _ := store.Devices("matt")
+				So(devices, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the code is from the existing device", func() {
+			code := (&otp.TOTP{Secret: "JBSWY3DPEHPK3PXP"}).Now().Get()
+			So(conversations.Answer(&gobot.Context{User: "matt", Channel: "D1", Text: code}), ShouldBeTrue)
+
+			Convey("Then I expect another device to be added", func() {
+				So((<-responses).Text, ShouldStartWith, "registering a google mfa device, google-2")
+
+				devices, _ := store.Devices("matt")
+				So(devices, ShouldHaveLength, 2)
+			})
+		})
+	})
+}
+
+func TestRevoke(t *testing.T) {
+	Convey("Given a user with two devices", t, func() {
+		store := NewMemoryStore()
+		So(store.Save("matt", Device{Name: "google-1", Secret: "JBSWY3DPEHPK3PXP"}), ShouldBeNil)
+		So(store.Save("matt", Device{Name: "google-2", Secret: "KRSXG5CTMVRXEZLU"}), ShouldBeNil)
+
+		conversations := gobot.Converse(gobot.Handlers{}.WithProvider(Provider(store)))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		questions := make(chan string, 1)
+		sender := gobot.SenderFunc(func(r *gobot.Response) error {
+			questions <- r.Text
+			return nil
+		})
+		revoke := func(name string) chan *gobot.Response {
+			responses := make(chan *gobot.Response, 1)
+			go func() {
+				resp, _ := conversations.OnMessage(&gobot.Context{User: "matt", Channel: "D1", Private: true, Text: "mfa revoke " + name, Sender: sender})
+				responses <- resp
+			}()
+			return responses
+		}
+		answer := func(code string) {
+			So(conversations.Answer(&gobot.Context{User: "matt", Channel: "D1", Text: code}), ShouldBeTrue)
+		}
+		remaining := func() int {
+			devices, _ := store.Devices("matt")
+			return len(devices)
+		}
+
+		Convey("When the code is from the device being revoked", func() {
+			responses := revoke("google-1")
+			So(<-questions, ShouldEqual, "Enter a code from one of your other devices to revoke google-1.")
+			answer((&otp.TOTP{Secret: "JBSWY3DPEHPK3PXP"}).Now().Get())
+
+			Convey("Then I expect it to be kept", func() {
+				So((<-responses).Text, ShouldEqual, "Unable to revoke google-1 => invalid MFA code")
+				So(remaining(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the code is from the other device", func() {
+			responses := revoke("google-1")
+			<-questions
+			answer((&otp.TOTP{Secret: "KRSXG5CTMVRXEZLU"}).Now().Get())
+
+			Convey("Then I expect it to be revoked", func() {
+				So((<-responses).Text, ShouldEqual, "Revoked mfa device, google-1")
+				So(remaining(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the last device is revoked", func() {
+			So(store.Delete("matt", "google-2"), ShouldBeNil)
+			responses := revoke("google-1")
+			So(<-questions, ShouldEqual, "google-1 is your last device.  Enter a code from it to revoke it.")
+
+			Convey("Then I expect a code from it to be required", func() {
+				answer("000000")
+				So((<-responses).Text, ShouldEqual, "Unable to revoke google-1 => invalid MFA code")
+				So(remaining(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the device doesn't exist", func() {
+			Convey("Then I expect no code to be asked for", func() {
+				So((<-revoke("yubikey-1")).Text, ShouldEqual, "Unable to find an mfa device with name, yubikey-1")
+			})
+		})
+	})
+}
@@ -0,0 +1,274 @@
+package mfa
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Device is an mfa device registered to a user
+type Device struct {
+	Name    string    `json:"name"`
+	Secret  string    `json:"secret"`
+	Created time.Time `json:"created"`
+}
+
+// Store persists the devices registered to each user
+type Store interface {
+	// Save adds or replaces the named device
+	Save(user string, device Device) error
+
+	// Devices returns all the devices registered to user
+	Devices(user string) ([]Device, error)
+
+	// Delete removes the named device
+	Delete(user, name string) error
+}
+
+// StoreFromEnv returns a FileStore when GOBOT_MFA_FILE is set and an in memory store otherwise.
+// Secrets in the FileStore are encrypted with GOBOT_MFA_KEY.
+func StoreFromEnv() (Store, error) {
+	filename := os.Getenv("GOBOT_MFA_FILE")
+	if filename == "" {
+		return NewMemoryStore(), nil
+	}
+
+	return NewFileStore(filename, os.Getenv("GOBOT_MFA_KEY"))
+}
+
+// -------------------------------------------------------
+
+type devices map[string][]Device
+
+func (d devices) save(user string, device Device) {
+	for i, existing := range d[user] {
+		if existing.Name == device.Name {
+			d[user][i] = device
+			return
+		}
+	}
+	d[user] = append(d[user], device)
+}
+
+func (d devices) delete(user, name string) error {
+	for i, existing := range d[user] {
+		if existing.Name == name {
+			d[user] = append(d[user][:i], d[user][i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no device named %s", name)
+}
+
+// -------------------------------------------------------
+
+type memoryStore struct {
+	mutex   sync.Mutex
+	devices devices
+}
+
+// NewMemoryStore returns a Store that forgets everything when the process exits
+func NewMemoryStore() Store {
+	return &memoryStore{devices: devices{}}
+}
+
+func (m *memoryStore) Save(user string, device Device) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.devices.save(user, device)
+	return nil
+}
+
+func (m *memoryStore) Devices(user string) ([]Device, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]Device{}, m.devices[user]...), nil
+}
+
+func (m *memoryStore) Delete(user, name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.devices.delete(user, name)
+}
+
+// -------------------------------------------------------
+
+// FileStore keeps devices in a json file with each secret encrypted using AES-GCM.  Changes are
+// made under an flock of Filename.lock, re-reading the file once locked, so the file may be shared
+// by several bot processes.  On windows, where there's no flock, it must not be shared.
+type FileStore struct {
+	Filename string
+	aead     cipher.AEAD
+	mutex    sync.Mutex
+}
+
+// NewFileStore returns a FileStore backed by filename.  The encryption key is derived from key,
+// which must not be empty.
+func NewFileStore(filename, key string) (*FileStore, error) {
+	if key == "" {
+		return nil, errors.New("an encryption key is required to store mfa secrets, set GOBOT_MFA_KEY")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStore{
+		Filename: filename,
+		aead:     aead,
+	}, nil
+}
+
+func (f *FileStore) Save(user string, device Device) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	d, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	secret, err := f.encrypt(device.Secret)
+	if err != nil {
+		return err
+	}
+	device.Secret = secret
+
+	d.save(user, device)
+	return f.write(d)
+}
+
+func (f *FileStore) Devices(user string) ([]Device, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	d, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Device{}
+	for _, device := range d[user] {
+		secret, err := f.decrypt(device.Secret)
+		if err != nil {
+			return nil, err
+		}
+		device.Secret = secret
+		results = append(results, device)
+	}
+
+	return results, nil
+}
+
+func (f *FileStore) Delete(user, name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	d, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	if err := d.delete(user, name); err != nil {
+		return err
+	}
+	return f.write(d)
+}
+
+func (f *FileStore) read() (devices, error) {
+	d := devices{}
+
+	data, err := ioutil.ReadFile(f.Filename)
+	if os.IsNotExist(err) {
+		return d, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &d)
+	return d, err
+}
+
+// write replaces the file atomically so concurrent readers never see a partial file
+func (f *FileStore) write(d devices) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Filename), ".mfa")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.Filename)
+}
+
+func (f *FileStore) encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := f.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (f *FileStore) decrypt(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	size := f.aead.NonceSize()
+	if len(data) < size {
+		return "", errors.New("mfa secret is corrupt")
+	}
+
+	plaintext, err := f.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", errors.New("unable to decrypt mfa secret; has GOBOT_MFA_KEY changed?")
+	}
+	return string(plaintext), nil
+}
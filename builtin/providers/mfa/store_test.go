@@ -0,0 +1,163 @@
+package mfa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testStore(store Store) {
+	Convey("When a device is saved", func() {
+		device := Device{Name: "google-1", Secret: "JBSWY3DPEHPK3PXP", Created: time.Now().UTC().Truncate(time.Second)}
+		So(store.Save("matt", device), ShouldBeNil)
+
+		Convey("Then I expect it to be returned for the user only", func() {
+			devices, err := store.Devices("matt")
+			So(err, ShouldBeNil)
+			So(devices, ShouldHaveLength, 1)
+			So(devices[0].Name, ShouldEqual, device.Name)
+			So(devices[0].Secret, ShouldEqual, device.Secret)
+			So(devices[0].Created.Equal(device.Created), ShouldBeTrue)
+
+			others, err := store.Devices("joe")
+			So(err, ShouldBeNil)
+			So(others, ShouldBeEmpty)
+		})
+
+		Convey("Then I expect saving the same name to replace it", func() {
+			device.Secret = "KRSXG5CTMVRXEZLU"
+			So(store.Save("matt", device), ShouldBeNil)
+
+			devices, err := store.Devices("matt")
+			So(err, ShouldBeNil)
+			So(devices, ShouldHaveLength, 1)
+			So(devices[0].Secret, ShouldEqual, "KRSXG5CTMVRXEZLU")
+		})
+
+		Convey("Then I expect it to be deleted by name", func() {
+			So(store.Delete("matt", "google-1"), ShouldBeNil)
+			So(store.Delete("matt", "google-1"), ShouldNotBeNil)
+
+			devices, err := store.Devices("matt")
+			So(err, ShouldBeNil)
+			So(devices, ShouldBeEmpty)
+		})
+	})
+
+	Convey("When devices are saved concurrently", func() {
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				store.Save("matt", Device{Name: fmt.Sprintf("google-%d", i), Secret: "JBSWY3DPEHPK3PXP"})
+			}(i)
+		}
+		wg.Wait()
+
+		Convey("Then I expect none to be lost", func() {
+			devices, err := store.Devices("matt")
+			So(err, ShouldBeNil)
+			So(devices, ShouldHaveLength, 20)
+		})
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	Convey("Given a memory store", t, func() {
+		testStore(NewMemoryStore())
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	Convey("Given a file store", t, func() {
+		dir, err := ioutil.TempDir("", "gobot-mfa")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+
+		filename := filepath.Join(dir, "mfa.json")
+		store, err := NewFileStore(filename, "top secret")
+		So(err, ShouldBeNil)
+
+		testStore(store)
+
+		Convey("When a device is written to disk", func() {
+			So(store.Save("matt", Device{Name: "google-1", Secret: "JBSWY3DPEHPK3PXP"}), ShouldBeNil)
+
+			Convey("Then I expect the secret to be encrypted on disk", func() {
+				data, err := ioutil.ReadFile(filename)
+				So(err, ShouldBeNil)
+				So(string(data), ShouldContainSubstring, "google-1")
+				So(string(data), ShouldNotContainSubstring, "JBSWY3DPEHPK3PXP")
+			})
+
+			Convey("Then I expect another store with the same key to read it", func() {
+				other, err := NewFileStore(filename, "top secret")
+				So(err, ShouldBeNil)
+
+				devices, err := other.Devices("matt")
+				So(err, ShouldBeNil)
+				So(devices[0].Secret, ShouldEqual, "JBSWY3DPEHPK3PXP")
+			})
+
+			Convey("Then I expect a store with the wrong key to fail", func() {
+				other, err := NewFileStore(filename, "wrong")
+				So(err, ShouldBeNil)
+
+				_, err = other.Devices("matt")
+				So(err, ShouldNotBeNil)
+				So(strings.Contains(err.Error(), "GOBOT_MFA_KEY"), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given two processes sharing a file store", t, func() {
+		dir, err := ioutil.TempDir("", "gobot-mfa")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+
+		// each store opens the lock file itself, just as a separate process would
+		filename := filepath.Join(dir, "mfa.json")
+		stores := []*FileStore{}
+		for i := 0; i < 2; i++ {
+			store, err := NewFileStore(filename, "top secret")
+			So(err, ShouldBeNil)
+			stores = append(stores, store)
+		}
+
+		Convey("When both save devices at once", func() {
+			wg := &sync.WaitGroup{}
+			for i := 0; i < 20; i++ {
+				for j, store := range stores {
+					wg.Add(1)
+					go func(store *FileStore, name string) {
+						defer wg.Done()
+						store.Save("matt", Device{Name: name, Secret: "JBSWY3DPEHPK3PXP"})
+					}(store, fmt.Sprintf("google-%d-%d", j, i))
+				}
+			}
+			wg.Wait()
+
+			Convey("Then I expect neither to lose the other's devices", func() {
+				devices, err := stores[0].Devices("matt")
+				So(err, ShouldBeNil)
+				So(devices, ShouldHaveLength, 40)
+			})
+		})
+	})
+
+	Convey("Given no encryption key", t, func() {
+		_, err := NewFileStore("mfa.json", "")
+
+		Convey("Then I expect the store to be refused", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
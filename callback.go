@@ -0,0 +1,63 @@
+package gobot
+
+import (
+	"context"
+	"fmt"
+)
+
+// Callback runs when a user presses a button whose Action is Name.  The Context identifies the
+// user who pressed the button and holds the button's Value in Text.  Callbacks are registered
+// alongside commands, via Provider#Callbacks or Handlers#WithCallbacks, so middleware applies to
+// them too.
+type Callback struct {
+	Provider string
+	Name     string
+
+	// Role, if set, is required to press the button
+	Role string
+
+	Run func(*Context)
+}
+
+func (cb *Callback) Examples() Examples {
+	return Examples{}
+}
+
+func (cb *Callback) OnLoad() error {
+	if cb.Name == "" {
+		return fmt.Errorf("callback requires a Name")
+	}
+	if cb.Run == nil {
+		return fmt.Errorf("callback, %s, requires a Run func", cb.Name)
+	}
+	return nil
+}
+
+func (cb *Callback) OnMessage(ctx *Context) (*Response, bool) {
+	if ctx.Action == "" || ctx.Action != cb.Name {
+		return nil, false
+	}
+
+	if !ctx.Allowed(cb.Role) {
+		ctx.Respond(fmt.Sprintf("Sorry, you aren't allowed to do that.  It requires the %s role.", cb.Role))
+		return ctx.result()
+	}
+
+	if ctx.Context == nil {
+		ctx.Context = context.Background()
+	}
+	if ctx.background == nil {
+		ctx.background = ctx.Context
+	}
+
+	cb.Run(ctx)
+	return ctx.result()
+}
+
+func (h Handlers) WithCallbacks(callbacks ...*Callback) Handlers {
+	handlers := make([]Handler, len(callbacks))
+	for i, cb := range callbacks {
+		handlers[i] = cb
+	}
+	return h.WithHandlers(handlers...)
+}
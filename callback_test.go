@@ -0,0 +1,51 @@
+package gobot
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCallback(t *testing.T) {
+	Convey("Given a provider with a command and a callback requiring a role", t, func() {
+		handlers := Handlers{}.WithProvider(&Provider{
+			Name: "gocd",
+			Role: "deployer",
+			Commands: []Command{{
+				Grammar: "approve",
+				Action:  func(c *Context) { c.Respond("typed") },
+			}},
+			Callbacks: []Callback{{
+				Name: "approve",
+				Run:  func(c *Context) { c.Respond("pressed " + c.Text) },
+			}},
+		}).Use(Authorize(Roles{"deployer": {Users: []string{"matt"}}}))
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		Convey("When the button is pressed", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "matt", Action: "approve", Text: "api"})
+
+			Convey("Then I expect the callback, not the command, to run", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "pressed api")
+			})
+		})
+
+		Convey("When the button is pressed by someone without the role", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "joe", Action: "approve", Text: "api"})
+
+			Convey("Then I expect to be refused", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldContainSubstring, "requires the deployer role")
+			})
+		})
+
+		Convey("When an unknown button is pressed", func() {
+			_, ok := handlers.OnMessage(&Context{User: "matt", Action: "reject", Text: "approve"})
+
+			Convey("Then I expect it to be ignored", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -1,8 +1,12 @@
 package gobot
 
 import (
+	"context"
+	"fmt"
 	"regexp"
+	"runtime/debug"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -15,8 +19,18 @@ type Command struct {
 	Grammars []string       `json:"grammars,omitempty"`
 	Summary  string         `json:"summary"`
 	Run      string         `json:"run"`
+	Role     string         `json:"role,omitempty"`
 	Action   func(*Context) `json:"-"`
-	matcher  matchers
+
+	// Timeout, if set, limits how long Action may run before the user is told the command timed out
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Confirm, if set, requires the command be confirmed before Action is run
+	Confirm Confirmation `json:"confirm,omitempty"`
+
+	// MFA, if set, requires a valid mfa code, either appended to the command or when prompted
+	MFA     bool `json:"mfa,omitempty"`
+	matcher matchers
 }
 
 func (c *Command) allGrammars() []string {
@@ -40,6 +54,7 @@ func (c *Command) Examples() Examples {
 			Provider: c.Provider,
 			Grammar:  grammar,
 			Summary:  c.Summary,
+			Role:     c.Role,
 		})
 	}
 
@@ -55,21 +70,28 @@ func (c *Command) OnLoad() error {
 			continue
 		}
 
-		grammarToCompile := grammar
-		if !strings.HasPrefix(grammarToCompile, "^") {
-			grammarToCompile = "^" + grammarToCompile
-		}
-		if !strings.HasSuffix(grammarToCompile, "$") {
-			grammarToCompile = grammarToCompile + "$"
-		}
-
-		matcher, err := regexp.Compile(grammarToCompile)
+		matcher, params, err := compileGrammar(grammar)
 		if err != nil {
 			return err
 		}
+		if c.MFA {
+			// accept an mfa code at the end of the command.  It's matched ahead of the grammar on its
+			// own so that a trailing code is never taken as an optional placeholder instead
+			pattern := strings.TrimSuffix(matcher.String(), "$") + `\s+(?P<` + mfaParam + `>\d{6})$`
+			withCode, err := regexp.Compile(pattern)
+			if err != nil {
+				return err
+			}
+			m = append(m, matcherNode{
+				grammar: grammar,
+				matcher: withCode,
+				params:  append(append([]param{}, params...), param{name: mfaParam, kind: defaultKind}),
+			})
+		}
 		m = append(m, matcherNode{
 			grammar: grammar,
 			matcher: matcher,
+			params:  params,
 		})
 
 		log.WithField("stage", "OnLoad").Debugf("loading grammar => %s", grammar)
@@ -80,40 +102,167 @@ func (c *Command) OnLoad() error {
 }
 
 func (c *Command) OnMessage(ctx *Context) (*Response, bool) {
-	if grammar, matches, ok := c.matcher.match(ctx.Text); ok {
-		log.WithField("stage", "grammar").Debugf("'%s' matched '%s' [%d]", ctx.Text, grammar, len(matches))
+	if ctx.Action != "" {
+		// a button press, which is handled by a Callback
+		return nil, false
+	}
+
+	if node, matches, ok := c.matcher.find(ctx.Text); ok {
+		log.WithField("stage", "grammar").Debugf("'%s' matched '%s' [%d]", ctx.Text, node.grammar, len(matches))
 		ctx.matches = matches
-		c.Action(ctx)
-		return ctx.response, ctx.ok
+
+		if ctx.Anonymous && (c.Role != "" || c.MFA || c.Confirm != NoConfirmation) {
+			ctx.Respond(fmt.Sprintf("Sorry, `%s` is restricted and I can't tell who you are.  Identify yourself and try again.", ctx.Text))
+			return ctx.result()
+		}
+		if !ctx.Allowed(c.Role) {
+			ctx.Respond(fmt.Sprintf("Sorry, you aren't allowed to run `%s`.  It requires the %s role.", ctx.Text, c.Role))
+			return ctx.result()
+		}
+
+		params, err := node.values(matches)
+		if err != nil {
+			ctx.Fail(err)
+			return ctx.result()
+		}
+		ctx.params = params
+
+		if ctx.Context == nil {
+			ctx.Context = context.Background()
+		}
+		if c.MFA {
+			if err := c.verify(ctx); err != nil {
+				ctx.Fail(err)
+				return ctx.result()
+			}
+		}
+		if err := c.confirm(ctx); err != nil {
+			ctx.Fail(err)
+			return ctx.result()
+		}
+
+		c.run(ctx, node.grammar)
+		return ctx.result()
 	}
 
 	return nil, false
 }
 
+// run calls Action, abandoning it with a timed out reply if it exceeds the Timeout
+func (c *Command) run(ctx *Context, grammar string) {
+	if ctx.background == nil {
+		ctx.background = ctx.Context
+	}
+	if c.Timeout <= 0 {
+		c.Action(ctx)
+		return
+	}
+
+	parent := ctx.Context
+	timeout, cancel := context.WithTimeout(parent, c.Timeout)
+	defer cancel()
+	ctx.Context = timeout
+
+	done := make(chan *panicked, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &panicked{value: r, stack: debug.Stack()}
+				return
+			}
+			done <- nil
+		}()
+		c.Action(ctx)
+	}()
+
+	select {
+	case p := <-done:
+		if p != nil {
+			panic(p.value) // re-panic on the calling goroutine so middleware can recover
+		}
+
+	case <-timeout.Done():
+		if parent.Err() != nil {
+			ctx.close(fmt.Sprintf("Sorry, `%s` was cancelled", ctx.Text))
+		} else {
+			ctx.close(fmt.Sprintf("Sorry, `%s` timed out after %v", ctx.Text, c.Timeout))
+		}
+		log.WithField("stage", "timeout").Warnf("'%s' abandoned => %v", ctx.Text, timeout.Err())
+
+		// nobody is left to recover a panic from the abandoned Action, so at least record it
+		go func() {
+			if p := <-done; p != nil {
+				log.WithFields(log.Fields{
+					"stage":   "timeout",
+					"grammar": grammar,
+					"user":    ctx.User,
+				}).Errorf("recovered from panic in abandoned '%s' => %v\n%s", ctx.Text, p.value, p.stack)
+			}
+		}()
+	}
+}
+
+// panicked holds a panic recovered from an Action along with where it happened
+type panicked struct {
+	value interface{}
+	stack []byte
+}
+
 // -------------------------------------------------------
 
 type matcherNode struct {
 	grammar string
 	matcher *regexp.Regexp
+	params  []param
+}
+
+// values returns the named placeholder values from matches, validating each against its type
+func (n matcherNode) values(matches []string) (map[string]string, error) {
+	values := map[string]string{}
+
+	for _, p := range n.params {
+		value := matches[n.matcher.SubexpIndex(p.name)]
+		if value == "" {
+			continue
+		}
+
+		if validate := Kinds[p.kind].Validate; validate != nil {
+			if err := validate(value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", p.name, err.Error())
+			}
+		}
+		values[p.name] = value
+	}
+
+	return values, nil
 }
 
 type matchers []matcherNode
 
 func (m matchers) match(text string) (string, []string, bool) {
+	node, matches, ok := m.find(text)
+	return node.grammar, matches, ok
+}
+
+func (m matchers) find(text string) (matcherNode, []string, bool) {
 	for _, node := range m {
 		if matches := node.matcher.FindStringSubmatch(text); matches != nil {
-			return node.grammar, matches, true
+			return node, matches, true
 		}
 	}
 
-	return "", nil, false
+	return matcherNode{}, nil, false
 }
 
 // -------------------------------------------------------
 
 type Provider struct {
-	Name     string
-	Commands []Command
+	Name string
+
+	// Role, if set, is required by any of the Commands that don't specify their own
+	Role      string
+	Commands  []Command
+	Callbacks []Callback
 }
 
 func (p *Provider) asHandlers() Handlers {
@@ -123,9 +272,21 @@ func (p *Provider) asHandlers() Handlers {
 		for _, c := range p.Commands {
 			command := c
 			command.Provider = p.Name
+			if command.Role == "" {
+				command.Role = p.Role
+			}
 			handlers = handlers.WithCommands(&command)
 		}
 	}
 
+	for _, cb := range p.Callbacks {
+		callback := cb
+		callback.Provider = p.Name
+		if callback.Role == "" {
+			callback.Role = p.Role
+		}
+		handlers = handlers.WithCallbacks(&callback)
+	}
+
 	return handlers
 }
@@ -1,11 +1,36 @@
 package gobot
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// lockedBuffer collects log output written from other goroutines
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
 func TestCommand(t *testing.T) {
 	content := "hello world"
 	action := func(c *Context) {
@@ -81,3 +106,256 @@ func TestCommand(t *testing.T) {
 		})
 	})
 }
+
+func TestCommandTimeout(t *testing.T) {
+	Convey("Given a command with a timeout", t, func() {
+		release := make(chan struct{})
+		command := &Command{
+			Grammar: "slow",
+			Timeout: 10 * time.Millisecond,
+			Action: func(c *Context) {
+				<-release
+				c.Respond("finished")
+			},
+		}
+		So(command.OnLoad(), ShouldBeNil)
+
+		Reset(func() {
+			close(release)
+		})
+
+		Convey("When the action exceeds the timeout", func() {
+			resp, ok := command.OnMessage(&Context{Text: "slow"})
+
+			Convey("Then I expect the user to be told the command timed out", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "Sorry, `slow` timed out after 10ms")
+			})
+		})
+
+		Convey("When the action panics after the timeout", func() {
+			output := &lockedBuffer{}
+			log.SetOutput(output)
+			defer log.SetOutput(os.Stderr)
+
+			panicked := make(chan struct{})
+			command := &Command{
+				Grammar: "slow",
+				Timeout: 10 * time.Millisecond,
+				Action: func(c *Context) {
+					defer close(panicked)
+					<-c.Done()
+					panic("boom")
+				},
+			}
+			So(command.OnLoad(), ShouldBeNil)
+
+			resp, ok := command.OnMessage(&Context{Text: "slow", User: "matt"})
+			<-panicked
+			time.Sleep(10 * time.Millisecond) // the panic is logged once recovered
+
+			Convey("Then I expect the panic to be logged with the grammar and user", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "Sorry, `slow` timed out after 10ms")
+				So(output.String(), ShouldContainSubstring, "recovered from panic in abandoned 'slow' => boom")
+				So(output.String(), ShouldContainSubstring, "grammar=slow")
+				So(output.String(), ShouldContainSubstring, "user=matt")
+			})
+		})
+
+		Convey("When the parent context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			resp, ok := command.OnMessage(&Context{Context: ctx, Text: "slow"})
+
+			Convey("Then I expect the user to be told the command was cancelled", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "Sorry, `slow` was cancelled")
+			})
+		})
+	})
+}
+
+func TestContextSay(t *testing.T) {
+	Convey("Given a command that reports progress and finishes in the background", t, func() {
+		sent := make(chan string, 10)
+		sender := SenderFunc(func(r *Response) error {
+			sent <- r.Text
+			return nil
+		})
+
+		command := &Command{
+			Grammar: "deploy",
+			Action: func(c *Context) {
+				c.Say("starting")
+				c.Respond("scheduled")
+				c.Go(func(c *Context) {
+					c.Say("halfway")
+					c.Respond("finished")
+				})
+			},
+		}
+		So(command.OnLoad(), ShouldBeNil)
+
+		Convey("When the listener provides a Sender", func() {
+			resp, ok := command.OnMessage(&Context{Text: "deploy", Sender: sender})
+
+			Convey("Then I expect each message to be sent in order", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "")
+				So(<-sent, ShouldEqual, "starting")
+				So(<-sent, ShouldEqual, "scheduled")
+				So(<-sent, ShouldEqual, "halfway")
+				So(<-sent, ShouldEqual, "finished")
+			})
+		})
+
+		Convey("When the listener provides no Sender", func() {
+			resp, ok := command.OnMessage(&Context{Text: "deploy"})
+
+			Convey("Then I expect everything in the final response", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "starting\nscheduled\nhalfway\nfinished")
+			})
+		})
+	})
+}
+
+func TestCommandRole(t *testing.T) {
+	Convey("Given a command that requires a role", t, func() {
+		handlers := Handlers{}.WithProvider(&Provider{
+			Name: "go",
+			Role: "deployer",
+			Commands: []Command{
+				{
+					Grammar: "go build <pipeline>",
+					Action:  func(c *Context) { c.Respond("scheduled") },
+				},
+			},
+		}).Use(Authorize(Roles{
+			"deployer": {Users: []string{"matt"}, Channels: []string{"ops"}},
+		}))
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		Convey("Then I expect the role to be inherited from the provider", func() {
+			So(handlers.Examples()[0].Role, ShouldEqual, "deployer")
+		})
+
+		Convey("When a user holding the role runs it", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "matt", Channel: "ops", Text: "go build prod"})
+			So(ok, ShouldBeTrue)
+			So(resp.Text, ShouldEqual, "scheduled")
+		})
+
+		Convey("When the user holds the role but is in another channel", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "matt", Channel: "general", Text: "go build prod"})
+			So(ok, ShouldBeTrue)
+			So(resp.Text, ShouldEqual, "Sorry, you aren't allowed to run `go build prod`.  It requires the deployer role.")
+		})
+
+		Convey("When a user without the role runs it", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "joe", Channel: "ops", Text: "go build prod"})
+			So(ok, ShouldBeTrue)
+			So(resp.Text, ShouldStartWith, "Sorry, you aren't allowed")
+		})
+
+		Convey("When an anonymous user with the name of one holding the role runs it", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "matt", Channel: "ops", Text: "go build prod", Anonymous: true})
+			So(ok, ShouldBeTrue)
+			So(resp.Text, ShouldEqual, "Sorry, `go build prod` is restricted and I can't tell who you are.  Identify yourself and try again.")
+		})
+	})
+
+	Convey("Given a command anyone may run", t, func() {
+		handlers := Handlers{}.WithCommands(&Command{
+			Grammar: "go status",
+			Action:  func(c *Context) { c.Respond("all green") },
+		})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		Convey("Then I expect anonymous users to be able to run it", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "matt", Text: "go status", Anonymous: true})
+			So(ok, ShouldBeTrue)
+			So(resp.Text, ShouldEqual, "all green")
+		})
+	})
+}
+
+type verifierFunc func(user, code string) error
+
+func (fn verifierFunc) Verify(user, code string) error {
+	return fn(user, code)
+}
+
+func TestCommandMFA(t *testing.T) {
+	Convey("Given an MFA protected command", t, func() {
+		handlers := Handlers{}.WithCommands(&Command{
+			Grammar: "go build <pipeline>",
+			MFA:     true,
+			Action:  func(c *Context) { c.Respond("scheduled " + c.String("pipeline")) },
+		})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		verifier := verifierFunc(func(user, code string) error {
+			if code != "123456" {
+				return errors.New("invalid MFA code")
+			}
+			return nil
+		})
+
+		Convey("When a valid code is appended", func() {
+			ctx := &Context{User: "matt", Text: "go build prod 123456"}
+			resp, ok := handlers.Use(RequireMFA(verifier)).OnMessage(ctx)
+
+			Convey("Then I expect the action to run without the code", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "scheduled prod")
+				So(ctx.Text, ShouldEqual, "go build prod")
+			})
+		})
+
+		Convey("When an invalid code is appended", func() {
+			resp, ok := handlers.Use(RequireMFA(verifier)).OnMessage(&Context{User: "matt", Text: "go build prod 654321"})
+
+			Convey("Then I expect the action not to run", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "Sorry, unable to verify your MFA code => invalid MFA code")
+			})
+		})
+
+		Convey("When no verifier has been configured", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "matt", Text: "go build prod 123456"})
+
+			Convey("Then I expect the command to be refused", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldContainSubstring, "MFA isn't enabled")
+			})
+		})
+	})
+
+	Convey("Given an MFA protected command with trailing text", t, func() {
+		handlers := Handlers{}.WithCommands(&Command{
+			Grammar: "go build <pipeline> [<options:text>]",
+			MFA:     true,
+			Action:  func(c *Context) { c.Respond("scheduled " + c.String("pipeline") + " with " + c.String("options")) },
+		}).Use(RequireMFA(verifierFunc(func(user, code string) error {
+			if code != "123456" {
+				return errors.New("invalid MFA code")
+			}
+			return nil
+		})))
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		Convey("Then I expect the code not to be mistaken for part of the text", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "matt", Text: "go build prod rev=abc env.FOO=bar 123456"})
+			So(ok, ShouldBeTrue)
+			So(resp.Text, ShouldEqual, "scheduled prod with rev=abc env.FOO=bar")
+		})
+
+		Convey("Then I expect a code alone not to be mistaken for the text", func() {
+			resp, ok := handlers.OnMessage(&Context{User: "matt", Text: "go build prod 123456"})
+			So(ok, ShouldBeTrue)
+			So(resp.Text, ShouldEqual, "scheduled prod with ")
+		})
+	})
+}
@@ -0,0 +1,149 @@
+package gobot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// -------------------------------------------------------
+
+// Confirmation describes who, if anyone, must confirm a command before its Action is run
+type Confirmation int
+
+const (
+	// NoConfirmation runs the Action immediately
+	NoConfirmation Confirmation = iota
+
+	// ConfirmSelf requires the user who issued the command to reply yes
+	ConfirmSelf
+
+	// ConfirmOther requires someone other than the user who issued the command to reply yes
+	ConfirmOther
+)
+
+const (
+	DefaultConfirmationTimeout = 60 * time.Second
+)
+
+var confirmations = map[string]Confirmation{
+	"none":  NoConfirmation,
+	"self":  ConfirmSelf,
+	"other": ConfirmOther,
+}
+
+// ParseConfirmation converts none, self, or other into a Confirmation
+func ParseConfirmation(text string) (Confirmation, error) {
+	if text == "" {
+		return NoConfirmation, nil
+	}
+
+	confirmation, found := confirmations[strings.ToLower(text)]
+	if !found {
+		return NoConfirmation, fmt.Errorf("unknown confirmation, %s.  Expected one of none, self, or other", text)
+	}
+	return confirmation, nil
+}
+
+func isYes(text string) bool {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "y", "yes", "approve", "confirm":
+		return true
+	}
+	return false
+}
+
+func isNo(text string) bool {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "n", "no", "cancel", "abort":
+		return true
+	}
+	return false
+}
+
+// confirm asks for confirmation as dictated by the command's Confirm policy
+func (c *Command) confirm(ctx *Context) error {
+	return ctx.ConfirmWith(c.Confirm, c.Role, fmt.Sprintf("About to %s: `%s`", c.Summary, ctx.Text))
+}
+
+// Confirm asks the user who issued the command to reply yes to prompt, returning an error that
+// explains why not if they don't.  Use it from an Action when whether confirmation is needed
+// depends on what the command resolves to; otherwise set Command.Confirm.
+func (c *Context) Confirm(prompt string) error {
+	return c.ConfirmWith(ConfirmSelf, "", prompt)
+}
+
+// ConfirmWith is Confirm with the given policy; with ConfirmOther, approvers need role.  Use it from
+// an Action so the prompt can show what the command resolved to rather than what was typed.  When
+// the listener has set a Confirmer with role, it confirms without asking.
+func (c *Context) ConfirmWith(policy Confirmation, role, prompt string) error {
+	timeout := DefaultConfirmationTimeout
+
+	var accept func(*Context) bool
+	switch policy {
+	case ConfirmSelf:
+		prompt = prompt + fmt.Sprintf(" - reply `yes` within %v to confirm", timeout)
+		accept = func(reply *Context) bool {
+			return reply.User == c.User
+		}
+
+	case ConfirmOther:
+		prompt = prompt + fmt.Sprintf(" - someone other than %s must reply `yes` within %v to approve", c.User, timeout)
+		if role != "" {
+			prompt = prompt + fmt.Sprintf(".  Approvers require the %s role", role)
+		}
+		accept = func(reply *Context) bool {
+			if reply.User == c.User {
+				return isNo(reply.Text)
+			}
+			return isYes(reply.Text) && !reply.Anonymous && c.allows(reply.User, role)
+		}
+
+	default:
+		return nil
+	}
+
+	if c.Anonymous {
+		return fmt.Errorf("Sorry, `%s` must be confirmed and I can't tell who you are.  Identify yourself and try again.", c.Text)
+	}
+	if c.Confirmer != "" {
+		if !c.allows(c.Confirmer, role) {
+			return fmt.Errorf("Sorry, `%s` must be confirmed by someone with the %s role", c.Text, role)
+		}
+		log.WithFields(log.Fields{
+			"user":         c.User,
+			"text":         c.Text,
+			"confirmed-by": c.Confirmer,
+		}).Info("command confirmed by listener")
+		c.ConfirmedBy = c.Confirmer
+		return nil
+	}
+
+	reply, err := c.await(prompt, timeout, accept)
+	return c.confirmed(reply, err, timeout)
+}
+
+// confirmed interprets the reply to a request for confirmation, recording who confirmed
+func (c *Context) confirmed(reply *Context, err error, timeout time.Duration) error {
+	if err == ErrConversationsOffline {
+		return fmt.Errorf("Sorry, `%s` must be confirmed, which isn't possible from here.  Run it from chat instead.", c.Text)
+	} else if err == ErrNoAnswer {
+		return fmt.Errorf("Cancelled, `%s` was not confirmed within %v", c.Text, timeout)
+	} else if err != nil {
+		return err
+	}
+
+	if !isYes(reply.Text) {
+		return fmt.Errorf("Cancelled, `%s`", c.Text)
+	}
+
+	log.WithFields(log.Fields{
+		"user":         c.User,
+		"text":         c.Text,
+		"confirmed-by": reply.User,
+	}).Info("command confirmed")
+	c.ConfirmedBy = reply.User
+	return nil
+}
@@ -1,15 +1,66 @@
 package gobot
 
-import log "github.com/Sirupsen/logrus"
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
 
 // -------------------------------------------------------
 
+// Context describes a single message received by the bot.  It embeds a context.Context that is
+// cancelled when the bot shuts down or, if the Command specifies a Timeout, when the command times out.
 type Context struct {
-	User     string
-	Text     string
-	matches  []string
-	response *Response
-	ok       bool
+	context.Context
+	User    string
+	Channel string
+	Text    string
+
+	// Thread identifies the thread the message was posted in for listeners that support threads
+	// e.g. the slack thread_ts.  Replies and follow up questions stay within the thread.
+	Thread string
+
+	// Private is true when the message was sent directly to the bot e.g. a slack direct message,
+	// rather than in a channel others can read
+	Private bool
+
+	// Anonymous is true when the listener can't vouch for who sent the message e.g. an irc nick
+	// that isn't logged in to services.  Anonymous users are refused anything requiring a role, an
+	// mfa code, or confirmation, and can't approve commands for others.
+	Anonymous bool
+
+	// Action, when the message is a button press rather than text, identifies the Callback to run.
+	// Text holds the button's Value.
+	Action string
+
+	// ConfirmedBy holds the user who confirmed the command when the Command requires confirmation
+	ConfirmedBy string
+
+	// Confirmer, when set by the listener, confirms commands on the user's behalf rather than
+	// asking.  It's for clients that can't be asked, such as CI, but are trusted to act alone.
+	Confirmer string
+
+	// Sender, when provided by the listener, delivers messages to wherever this message came from
+	// before the command completes
+	Sender Sender
+
+	background    context.Context
+	bot           *Bot
+	conversations *Conversations
+	authorizer    Authorizer
+	verifier      Verifier
+	matches       []string
+	params        map[string]string
+	mutex         sync.Mutex
+	response      *Response
+	ok            bool
+	closed        bool
+	said          []string
 }
 
 func (c *Context) Match(index int) string {
@@ -21,7 +72,24 @@ func (c *Context) Match(index int) string {
 	return c.matches[index]
 }
 
+// String returns the value of the named grammar placeholder or "" if it was not provided
+func (c *Context) String(name string) string {
+	return c.params[name]
+}
+
+// Int returns the value of the named grammar placeholder as an int or 0 if it was not provided
+func (c *Context) Int(name string) int {
+	v, _ := strconv.Atoi(c.params[name])
+	return v
+}
+
 func (c *Context) Upload(attachment Attachment) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return
+	}
 	c.ok = true
 
 	if c.response == nil {
@@ -37,6 +105,13 @@ func (c *Context) Upload(attachment Attachment) {
 }
 
 func (c *Context) Respond(text string) *Response {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		// the reply has already been sent; hand back a response no one will read
+		return &Response{Text: text}
+	}
 	c.ok = true
 
 	if c.response == nil {
@@ -44,6 +119,7 @@ func (c *Context) Respond(text string) *Response {
 	}
 
 	c.response.Text = text
+	c.response.Blocks = nil
 	return c.response
 }
 
@@ -51,14 +127,196 @@ func (c *Context) Fail(err error) {
 	c.Respond(err.Error())
 }
 
+// Say immediately sends text to the user, ahead of the final response.  Listeners that can't send
+// messages early will receive text at the start of the final response instead.
+func (c *Context) Say(text string) error {
+	c.mutex.Lock()
+	c.ok = true
+	if c.Sender == nil {
+		c.said = append(c.said, text)
+	}
+	c.mutex.Unlock()
+
+	if c.Sender == nil {
+		return nil
+	}
+	if c.Context != nil && c.Err() != nil {
+		return c.Err()
+	}
+
+	return c.Sender.Send(&Response{Text: text})
+}
+
+// Go sends any response so far and then runs fn in the background, allowing long running commands
+// to reply right away and report back later via Say or Respond.  fn is not subject to the command
+// Timeout, but is cancelled as soon as the bot starts shutting down.  Shutdown then waits for fn
+// to return, so it should wind up promptly, and its response is still sent.
+func (c *Context) Go(fn func(*Context)) {
+	background := c.background
+	if background == nil {
+		background = c.Context
+	}
+	if background == nil {
+		background = context.Background()
+	}
+
+	child := &Context{
+		Context:       background,
+		User:          c.User,
+		Channel:       c.Channel,
+		Text:          c.Text,
+		Thread:        c.Thread,
+		Private:       c.Private,
+		Anonymous:     c.Anonymous,
+		ConfirmedBy:   c.ConfirmedBy,
+		Confirmer:     c.Confirmer,
+		Sender:        c.Sender,
+		bot:           c.bot,
+		conversations: c.conversations,
+		authorizer:    c.authorizer,
+		verifier:      c.verifier,
+		matches:       c.matches,
+		params:        c.params,
+	}
+
+	// send what we have so far so the background work is reported after it
+	c.mutex.Lock()
+	response := c.response
+	c.response = &Response{}
+	c.ok = true
+	c.mutex.Unlock()
+
+	if c.Sender == nil {
+		// nowhere to send background replies; do the work now and reply with the result
+		if response != nil {
+			c.Say(response.Text)
+			c.attach(response.Attachments...)
+		}
+		fn(child)
+		if response, ok := child.result(); ok {
+			c.Say(response.Text)
+			c.attach(response.Attachments...)
+		}
+		return
+	}
+
+	if response != nil {
+		c.send(response)
+	}
+
+	// background work counts as in flight so shutdown waits for it to report, but is cancelled
+	// once shutdown starts so it doesn't hold shutdown up
+	cancel := func() {}
+	if c.bot != nil {
+		c.bot.hold()
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(child.Context)
+		child.Context = ctx
+		go func(quit <-chan struct{}) {
+			select {
+			case <-quit:
+				cancel()
+			case <-ctx.Done():
+			}
+		}(c.bot.quitting())
+	}
+
+	go func() {
+		defer cancel()
+		defer func() {
+			if c.bot != nil {
+				defer c.bot.end()
+			}
+
+			if r := recover(); r != nil {
+				log.WithField("stage", "go").Errorf("recovered from panic in background '%s' => %v\n%s", c.Text, r, debug.Stack())
+				child.Fail(fmt.Errorf("Sorry, something went wrong while running `%s`", c.Text))
+			}
+
+			if response, ok := child.result(); ok {
+				c.send(response)
+			}
+		}()
+
+		fn(child)
+	}()
+}
+
+func (c *Context) send(response *Response) {
+	if err := c.Sender.Send(response); err != nil {
+		log.WithField("stage", "go").Warnf("unable to send response to '%s' => %s", c.Text, err.Error())
+	}
+}
+
+func (c *Context) attach(attachments ...Attachment) {
+	for _, a := range attachments {
+		c.Upload(a)
+	}
+}
+
+// close replaces the response with text and discards any subsequent responses
+func (c *Context) close(text string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ok = true
+	c.closed = true
+	c.response = &Response{Text: text}
+}
+
+// result returns the final response, prefixed by anything said that couldn't be sent early
+func (c *Context) result() (*Response, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.said) == 0 {
+		return c.response, c.ok
+	}
+
+	response := &Response{Text: strings.Join(c.said, "\n")}
+	if c.response != nil {
+		if len(c.response.Blocks) > 0 {
+			response.Add(c.response.Blocks...)
+		} else if c.response.Text != "" {
+			response.Append(c.response.Text)
+		}
+		response.Attachments = c.response.Attachments
+	}
+	return response, c.ok
+}
+
+// -------------------------------------------------------
+
+// Sender delivers a response to the user outside of the normal request/response cycle
+type Sender interface {
+	Send(*Response) error
+}
+
+type SenderFunc func(*Response) error
+
+func (fn SenderFunc) Send(response *Response) error {
+	return fn(response)
+}
+
 // -------------------------------------------------------
 
 type Response struct {
 	Text        string
 	Attachments []Attachment
+
+	// Blocks optionally holds a rich version of Text; see Add
+	Blocks []Block
+
+	// Replace, in response to a button press, replaces the message holding the button rather than
+	// posting a new message.  Listeners that can't edit messages post as usual.
+	Replace bool
 }
 
 func (r *Response) Append(text string) *Response {
 	r.Text = r.Text + "\n" + text
+	if len(r.Blocks) > 0 {
+		r.Blocks = append(r.Blocks, Section{Text: text})
+	}
 	return r
 }
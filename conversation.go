@@ -0,0 +1,169 @@
+package gobot
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// -------------------------------------------------------
+
+const (
+	DefaultConversationTimeout = 2 * time.Minute
+)
+
+var (
+	ErrNoAnswer             = errors.New("no answer received in time")
+	ErrConversationsOffline = errors.New("this listener doesn't support follow up questions")
+)
+
+// Answerer is implemented by handlers that wait on replies to questions.  Listeners offer it
+// messages that weren't addressed to the bot; Answer returns true if the message was consumed.
+type Answerer interface {
+	Answer(*Context) bool
+}
+
+// Conversations allows commands to ask follow up questions via Context#Ask.  It wraps the
+// Handler the listener dispatches to so that answers bypass grammar matching.
+type Conversations struct {
+	Handler Handler
+
+	// Timeout is how long to wait for an answer; defaults to DefaultConversationTimeout
+	Timeout time.Duration
+
+	mutex   sync.Mutex
+	pending []*question
+}
+
+// Converse wraps handler so that its commands may ask follow up questions
+func Converse(handler Handler) *Conversations {
+	return &Conversations{Handler: handler}
+}
+
+type question struct {
+	channel string
+	thread  string
+	accept  func(*Context) bool
+	answers chan *Context
+}
+
+func (cv *Conversations) Examples() Examples {
+	return cv.Handler.Examples()
+}
+
+func (cv *Conversations) OnLoad() error {
+	return cv.Handler.OnLoad()
+}
+
+func (cv *Conversations) OnMessage(c *Context) (*Response, bool) {
+	if cv.Answer(c) {
+		return &Response{}, true
+	}
+
+	c.conversations = cv
+	return cv.Handler.OnMessage(c)
+}
+
+func (cv *Conversations) Answer(c *Context) bool {
+	if c.User == "" || c.Action != "" {
+		return false
+	}
+
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	for i, q := range cv.pending {
+		if q.channel == c.Channel && (q.thread == "" || q.thread == c.Thread) && q.accept(c) {
+			cv.pending = append(cv.pending[:i], cv.pending[i+1:]...)
+			q.answers <- c
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cv *Conversations) expect(channel, thread string, accept func(*Context) bool) *question {
+	q := &question{
+		channel: channel,
+		thread:  thread,
+		accept:  accept,
+		answers: make(chan *Context, 1),
+	}
+
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	cv.pending = append(cv.pending, q)
+	return q
+}
+
+func (cv *Conversations) forget(q *question) {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	for i, p := range cv.pending {
+		if p == q {
+			cv.pending = append(cv.pending[:i], cv.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (cv *Conversations) timeout() time.Duration {
+	if cv.Timeout > 0 {
+		return cv.Timeout
+	}
+	return DefaultConversationTimeout
+}
+
+// -------------------------------------------------------
+
+// Ask sends question to the user and waits for the next message they send in the same channel,
+// or the same thread if the question was asked in one
+func (c *Context) Ask(question string) (string, error) {
+	answer, err := c.await(question, 0, func(reply *Context) bool {
+		return reply.User == c.User
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return answer.Text, nil
+}
+
+// await sends text and waits for the first message in this channel accepted by accept.  A zero
+// timeout uses the Conversations timeout.
+func (c *Context) await(text string, timeout time.Duration, accept func(*Context) bool) (*Context, error) {
+	cv := c.conversations
+	if cv == nil || c.Sender == nil {
+		return nil, ErrConversationsOffline
+	}
+
+	q := cv.expect(c.Channel, c.Thread, accept)
+	defer cv.forget(q)
+
+	if err := c.Say(text); err != nil {
+		return nil, err
+	}
+
+	var done <-chan struct{}
+	if c.Context != nil {
+		done = c.Done()
+	}
+
+	if timeout <= 0 {
+		timeout = cv.timeout()
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-q.answers:
+		return answer, nil
+	case <-timer.C:
+		return nil, ErrNoAnswer
+	case <-done:
+		return nil, c.Err()
+	}
+}
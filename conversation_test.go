@@ -0,0 +1,250 @@
+package gobot
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConversations(t *testing.T) {
+	Convey("Given a command that asks a follow up question", t, func() {
+		questions := make(chan string, 1)
+		sender := SenderFunc(func(r *Response) error {
+			questions <- r.Text
+			return nil
+		})
+
+		conversations := Converse(Handlers{}.WithCommands(&Command{
+			Grammar: "deploy",
+			Action: func(c *Context) {
+				stage, err := c.Ask("Which stage?")
+				if err != nil {
+					c.Fail(err)
+					return
+				}
+				c.Respond("deploying " + stage)
+			},
+		}))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		responses := make(chan *Response, 1)
+		go func() {
+			resp, _ := conversations.OnMessage(&Context{User: "matt", Channel: "ops", Text: "deploy", Sender: sender})
+			responses <- resp
+		}()
+		So(<-questions, ShouldEqual, "Which stage?")
+
+		Convey("When someone else speaks first", func() {
+			So(conversations.Answer(&Context{User: "joe", Channel: "ops", Text: "lunch?"}), ShouldBeFalse)
+
+			Convey("Then I expect the question to remain open for the user who was asked", func() {
+				So(conversations.Answer(&Context{User: "matt", Channel: "ops", Text: "prod"}), ShouldBeTrue)
+				So((<-responses).Text, ShouldEqual, "deploying prod")
+			})
+		})
+
+		Convey("When the answer is addressed to the bot", func() {
+			resp, ok := conversations.OnMessage(&Context{User: "matt", Channel: "ops", Text: "staging"})
+
+			Convey("Then I expect it to bypass grammar matching", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "")
+				So((<-responses).Text, ShouldEqual, "deploying staging")
+			})
+		})
+	})
+
+	Convey("Given a question asked within a thread", t, func() {
+		questions := make(chan string, 1)
+		sender := SenderFunc(func(r *Response) error {
+			questions <- r.Text
+			return nil
+		})
+
+		conversations := Converse(Handlers{}.WithCommands(&Command{
+			Grammar: "deploy",
+			Action: func(c *Context) {
+				stage, _ := c.Ask("Which stage?")
+				c.Respond("deploying " + stage)
+			},
+		}))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		responses := make(chan *Response, 1)
+		go func() {
+			resp, _ := conversations.OnMessage(&Context{User: "matt", Channel: "ops", Thread: "123.456", Text: "deploy", Sender: sender})
+			responses <- resp
+		}()
+		So(<-questions, ShouldEqual, "Which stage?")
+
+		Convey("Then I expect only an answer within the thread to be accepted", func() {
+			So(conversations.Answer(&Context{User: "matt", Channel: "ops", Text: "qa"}), ShouldBeFalse)
+			So(conversations.Answer(&Context{User: "matt", Channel: "ops", Thread: "123.456", Text: "prod"}), ShouldBeTrue)
+			So((<-responses).Text, ShouldEqual, "deploying prod")
+		})
+	})
+
+	Convey("Given a context without conversation support", t, func() {
+		_, err := (&Context{}).Ask("Which stage?")
+
+		Convey("Then I expect Ask to fail", func() {
+			So(err, ShouldEqual, ErrConversationsOffline)
+		})
+	})
+}
+
+func TestConfirmation(t *testing.T) {
+	Convey("Given a command that requires someone else to confirm", t, func() {
+		prompts := make(chan string, 1)
+		sender := SenderFunc(func(r *Response) error {
+			prompts <- r.Text
+			return nil
+		})
+
+		conversations := Converse(Handlers{}.WithCommands(&Command{
+			Grammar: "go build <pipeline>",
+			Summary: "schedule a pipeline",
+			Confirm: ConfirmOther,
+			Action: func(c *Context) {
+				c.Respond("scheduled " + c.String("pipeline") + ", approved by " + c.ConfirmedBy)
+			},
+		}))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		responses := make(chan *Response, 1)
+		go func() {
+			resp, _ := conversations.OnMessage(&Context{User: "matt", Channel: "ops", Text: "go build prod", Sender: sender})
+			responses <- resp
+		}()
+		So(<-prompts, ShouldStartWith, "About to schedule a pipeline: `go build prod`")
+
+		Convey("When the requester tries to approve their own command", func() {
+			So(conversations.Answer(&Context{User: "matt", Channel: "ops", Text: "yes"}), ShouldBeFalse)
+		})
+
+		Convey("When another user approves", func() {
+			So(conversations.Answer(&Context{User: "joe", Channel: "ops", Text: "yes"}), ShouldBeTrue)
+
+			Convey("Then I expect the action to run", func() {
+				So((<-responses).Text, ShouldEqual, "scheduled prod, approved by joe")
+			})
+		})
+
+		Convey("When the requester cancels", func() {
+			So(conversations.Answer(&Context{User: "matt", Channel: "ops", Text: "no"}), ShouldBeTrue)
+
+			Convey("Then I expect the action not to run", func() {
+				So((<-responses).Text, ShouldEqual, "Cancelled, `go build prod`")
+			})
+		})
+	})
+}
+
+func TestConfirm(t *testing.T) {
+	Convey("Given an action that decides to ask for confirmation", t, func() {
+		prompts := make(chan string, 1)
+		sender := SenderFunc(func(r *Response) error {
+			prompts <- r.Text
+			return nil
+		})
+
+		conversations := Converse(Handlers{}.WithCommands(&Command{
+			Grammar: "go pause <target>",
+			Action: func(c *Context) {
+				if err := c.Confirm("About to pause 2 pipelines"); err != nil {
+					c.Fail(err)
+					return
+				}
+				c.Respond("paused, confirmed by " + c.ConfirmedBy)
+			},
+		}))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		responses := make(chan *Response, 1)
+		go func() {
+			resp, _ := conversations.OnMessage(&Context{User: "matt", Channel: "ops", Text: "go pause payments-*", Sender: sender})
+			responses <- resp
+		}()
+		So(<-prompts, ShouldStartWith, "About to pause 2 pipelines - reply `yes` within")
+
+		Convey("When someone else replies", func() {
+			So(conversations.Answer(&Context{User: "joe", Channel: "ops", Text: "yes"}), ShouldBeFalse)
+		})
+
+		Convey("When the user confirms", func() {
+			So(conversations.Answer(&Context{User: "matt", Channel: "ops", Text: "yes"}), ShouldBeTrue)
+
+			Convey("Then I expect the action to continue", func() {
+				So((<-responses).Text, ShouldEqual, "paused, confirmed by matt")
+			})
+		})
+
+		Convey("When the user declines", func() {
+			So(conversations.Answer(&Context{User: "matt", Channel: "ops", Text: "no"}), ShouldBeTrue)
+
+			Convey("Then I expect the action to stop", func() {
+				So((<-responses).Text, ShouldEqual, "Cancelled, `go pause payments-*`")
+			})
+		})
+	})
+
+	Convey("Given an action that asks someone else to approve what it resolved", t, func() {
+		prompts := make(chan string, 1)
+		sender := SenderFunc(func(r *Response) error {
+			prompts <- r.Text
+			return nil
+		})
+
+		conversations := Converse(Handlers{}.WithCommands(&Command{
+			Grammar: "go build <pipeline>",
+			Action: func(c *Context) {
+				if err := c.ConfirmWith(ConfirmOther, "", "About to schedule `api-prod`"); err != nil {
+					c.Fail(err)
+					return
+				}
+				c.Respond("scheduled, approved by " + c.ConfirmedBy)
+			},
+		}))
+		So(conversations.OnLoad(), ShouldBeNil)
+
+		responses := make(chan *Response, 1)
+		go func() {
+			resp, _ := conversations.OnMessage(&Context{User: "matt", Channel: "ops", Text: "go build api", Sender: sender})
+			responses <- resp
+		}()
+
+		Convey("Then I expect the prompt to show the resolved pipeline and another user to approve it", func() {
+			So(<-prompts, ShouldStartWith, "About to schedule `api-prod` - someone other than matt must reply `yes`")
+			So(conversations.Answer(&Context{User: "matt", Channel: "ops", Text: "yes"}), ShouldBeFalse)
+			So(conversations.Answer(&Context{User: "sam", Channel: "ops", Text: "yes", Anonymous: true}), ShouldBeFalse)
+			So(conversations.Answer(&Context{User: "joe", Channel: "ops", Text: "yes"}), ShouldBeTrue)
+			So((<-responses).Text, ShouldEqual, "scheduled, approved by joe")
+		})
+	})
+
+	Convey("Given a listener that confirms on the user's behalf", t, func() {
+		c := &Context{User: "http:ci", Text: "go approve api-prod", Confirmer: "http:ci", authorizer: Roles{"approver": {Users: []string{"http:ci"}}}}
+
+		Convey("Then I expect the command to be confirmed without asking", func() {
+			So(c.ConfirmWith(ConfirmOther, "approver", "About to approve `api-prod`"), ShouldBeNil)
+			So(c.ConfirmedBy, ShouldEqual, "http:ci")
+		})
+
+		Convey("Then I expect the confirmer to need the approver role", func() {
+			err := c.ConfirmWith(ConfirmOther, "deployer", "About to approve `api-prod`")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Sorry, `go approve api-prod` must be confirmed by someone with the deployer role")
+			So(c.ConfirmedBy, ShouldEqual, "")
+		})
+	})
+
+	Convey("Given a listener without conversations", t, func() {
+		c := &Context{Text: "go pause payments-*"}
+
+		Convey("Then I expect Confirm to explain that it can't", func() {
+			err := c.Confirm("About to pause 2 pipelines")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "Sorry, `go pause payments-*` must be confirmed")
+		})
+	})
+}
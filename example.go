@@ -6,6 +6,7 @@ type Example struct {
 	Grammar  string
 	Summary  string
 	Provider string
+	Role     string
 }
 
 type Examples []Example
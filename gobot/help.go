@@ -14,8 +14,8 @@ func help(name string, handler gobot.Handler) gobot.Handler {
 		Action: func(c *gobot.Context) {
 			response := c.Respond("Help:")
 
-			// 1. retrieve all the examples
-			all := handler.Examples()
+			// 1. retrieve all the examples the caller is allowed to run
+			all := handler.Examples().Filter(func(e gobot.Example) bool { return c.Allowed(e.Role) })
 			all = append(all, gobot.Example{
 				Provider: BuiltinProvider,
 				Grammar:  g,
@@ -2,11 +2,15 @@ package main
 
 import (
 	"os"
-	"sync"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"github.com/savaki/gobot"
+	"github.com/savaki/gobot/builtin/listeners/console"
+	"github.com/savaki/gobot/builtin/listeners/httpbot"
+	"github.com/savaki/gobot/builtin/listeners/irc"
+	"github.com/savaki/gobot/builtin/listeners/matrix"
+	"github.com/savaki/gobot/builtin/listeners/mattermost"
 	"github.com/savaki/gobot/builtin/listeners/slackbot"
 	"github.com/savaki/gobot/builtin/providers/gocd"
 	"github.com/savaki/gobot/builtin/providers/mfa"
@@ -17,10 +21,24 @@ const (
 )
 
 var (
-	flagSlack   = cli.BoolFlag{"slack", "enable slack listener", "GOBOT_SLACK"}
-	flagMfa     = cli.BoolFlag{"mfa", "enable mfa provider [EXPERIMENTAL]", ""}
-	flagName    = cli.StringFlag{"name", "gobot", "the name of the bot", "GOBOT_NAME"}
-	flagVerbose = cli.BoolFlag{"verbose", "verbose level logging", "GOBOT_VERBOSE"}
+	flagSlack             = cli.BoolFlag{"slack", "enable slack listener", "GOBOT_SLACK"}
+	flagSlackSuggest      = cli.BoolFlag{"slack-suggest", "suggest similar commands when a slack message matches none", "GOBOT_SLACK_SUGGEST"}
+	flagConsole           = cli.BoolFlag{"console", "enable interactive console listener", ""}
+	flagConsoleDir        = cli.StringFlag{"console-dir", "gobot-attachments", "directory the console listener saves attachments to", "GOBOT_CONSOLE_DIR"}
+	flagConsoleSuggest    = cli.BoolTFlag{"console-suggest", "suggest similar commands when console input matches none; on unless set to false", "GOBOT_CONSOLE_SUGGEST"}
+	flagHttp              = cli.BoolFlag{"http", "enable http listener; requires GOBOT_HTTP_TOKENS, name[@channel][+confirm]:token,...", "GOBOT_HTTP"}
+	flagHttpAddr          = cli.StringFlag{"http-addr", httpbot.DefaultAddr, "address the http listener binds to", "GOBOT_HTTP_ADDR"}
+	flagHttpSuggest       = cli.BoolFlag{"http-suggest", "suggest similar commands when an http request matches none", "GOBOT_HTTP_SUGGEST"}
+	flagIrc               = cli.BoolFlag{"irc", "enable irc listener; requires GOBOT_IRC_SERVER", "GOBOT_IRC"}
+	flagIrcSuggest        = cli.BoolFlag{"irc-suggest", "suggest similar commands when an irc message matches none", "GOBOT_IRC_SUGGEST"}
+	flagMattermost        = cli.BoolFlag{"mattermost", "enable mattermost listener; requires GOBOT_MATTERMOST_URL and GOBOT_MATTERMOST_TOKEN", "GOBOT_MATTERMOST"}
+	flagMattermostSuggest = cli.BoolFlag{"mattermost-suggest", "suggest similar commands when a mattermost message matches none", "GOBOT_MATTERMOST_SUGGEST"}
+	flagMatrix            = cli.BoolFlag{"matrix", "enable matrix listener; requires GOBOT_MATRIX_URL and GOBOT_MATRIX_TOKEN", "GOBOT_MATRIX"}
+	flagMatrixSuggest     = cli.BoolFlag{"matrix-suggest", "suggest similar commands when a matrix message matches none", "GOBOT_MATRIX_SUGGEST"}
+	flagMfa               = cli.BoolFlag{"mfa", "enable mfa provider and mfa protected commands", "GOBOT_MFA"}
+	flagName              = cli.StringFlag{"name", "gobot", "the name of the bot", "GOBOT_NAME"}
+	flagRoles             = cli.StringFlag{"roles", "", "json file assigning users to roles; all commands are allowed if omitted", "GOBOT_ROLES"}
+	flagVerbose           = cli.BoolFlag{"verbose", "verbose level logging", "GOBOT_VERBOSE"}
 )
 
 func main() {
@@ -29,8 +47,22 @@ func main() {
 	app.Usage = "ThoughtWork Go plugin for chatops"
 	app.Flags = []cli.Flag{
 		flagSlack,
+		flagSlackSuggest,
+		flagConsole,
+		flagConsoleDir,
+		flagConsoleSuggest,
+		flagHttp,
+		flagHttpAddr,
+		flagHttpSuggest,
+		flagIrc,
+		flagIrcSuggest,
+		flagMattermost,
+		flagMattermostSuggest,
+		flagMatrix,
+		flagMatrixSuggest,
 		flagMfa,
 		flagName,
+		flagRoles,
 		flagVerbose,
 	}
 	app.Action = Run
@@ -50,29 +82,64 @@ func Run(c *cli.Context) {
 		log.Debugf("setting log level to debug")
 	}
 
+	var mfaStore mfa.Store
+	if c.Bool(flagMfa.Name) {
+		store, err := mfa.StoreFromEnv()
+		assert(err)
+		mfaStore = store
+	}
+
 	handlers := gobot.Handlers{}
 	handlers = handlers.WithProvider(gocd.Provider())
-	if c.Bool(flagMfa.Name) {
-		handlers = handlers.WithProvider(mfa.Provider())
+	if mfaStore != nil {
+		handlers = handlers.WithProvider(mfa.Provider(mfaStore))
 	}
 	handlers = handlers.WithHandlers(help(name, handlers))
 
+	middleware := []gobot.Middleware{gobot.Logger(), gobot.Recover()}
+	if mfaStore != nil {
+		middleware = append(middleware, gobot.RequireMFA(mfa.Verifier(mfaStore)))
+	}
+	if filename := c.String(flagRoles.Name); filename != "" {
+		roles, err := gobot.LoadRoles(filename)
+		assert(err)
+		middleware = append(middleware, gobot.Authorize(roles))
+	}
+	handlers = handlers.Use(middleware...)
+
 	err := handlers.OnLoad()
 	assert(err)
 
-	var wg sync.WaitGroup
-
-	// start the slack listener
+	bot := &gobot.Bot{}
 	if c.Bool(flagSlack.Name) {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			err := slackbot.Listen(name, handlers)
-			assert(err)
-		}()
+		bot.Add(slackbot.Listener(name), listenerHandler(name, handlers, c.Bool(flagSlackSuggest.Name)))
+	}
+	if c.Bool(flagConsole.Name) {
+		bot.Add(console.Listener(name, c.String(flagConsoleDir.Name)), listenerHandler(name, handlers, c.BoolT(flagConsoleSuggest.Name)))
+	}
+	if c.Bool(flagHttp.Name) {
+		bot.Add(httpbot.Listener(c.String(flagHttpAddr.Name)), listenerHandler(name, handlers, c.Bool(flagHttpSuggest.Name)))
+	}
+	if c.Bool(flagIrc.Name) {
+		bot.Add(irc.Listener(name), listenerHandler(name, handlers, c.Bool(flagIrcSuggest.Name)))
+	}
+	if c.Bool(flagMattermost.Name) {
+		bot.Add(mattermost.Listener(name), listenerHandler(name, handlers, c.Bool(flagMattermostSuggest.Name)))
+	}
+	if c.Bool(flagMatrix.Name) {
+		bot.Add(matrix.Listener(name), listenerHandler(name, handlers, c.Bool(flagMatrixSuggest.Name)))
 	}
 
-	wg.Wait()
+	// runs until SIGINT or SIGTERM, restarting any listener that fails
+	err = bot.Run()
+	assert(err)
+}
 
+// listenerHandler builds the handler for a single listener, optionally appending a did-you-mean
+// fallback, and allowing commands to ask follow up questions
+func listenerHandler(name string, handlers gobot.Handlers, suggest bool) gobot.Handler {
+	if suggest {
+		handlers = handlers.WithHandlers(&gobot.Suggestions{Name: name, Handler: handlers})
+	}
+	return gobot.Converse(handlers)
 }
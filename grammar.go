@@ -0,0 +1,170 @@
+package gobot
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -------------------------------------------------------
+
+// Kind describes a placeholder type that may be used within a grammar e.g. <count:int>
+type Kind struct {
+	// Pattern is the regular expression the placeholder matches
+	Pattern string
+
+	// Validate, if set, checks the matched value before the Action is called
+	Validate func(value string) error
+}
+
+// Kinds contains the placeholder types understood by typed grammars.  Placeholders
+// without a type e.g. <pipeline> are treated as words.
+var Kinds = map[string]Kind{
+	"word": {
+		Pattern: `\S+`,
+	},
+	"int": {
+		Pattern: `\S+`,
+		Validate: func(value string) error {
+			if _, err := strconv.Atoi(value); err != nil {
+				return fmt.Errorf("expected a number, got '%s'", value)
+			}
+			return nil
+		},
+	},
+	"text": {
+		// lazy so that text doesn't swallow a trailing mfa code; grammars are anchored, so text
+		// otherwise still runs to the end of the message
+		Pattern: `.+?`,
+	},
+}
+
+const defaultKind = "word"
+
+var (
+	// placeholders stand alone as tokens, which keeps named groups in raw regular expressions
+	// e.g. (?P<name>\w+) from being mistaken for them
+	reHasPlaceholder = regexp.MustCompile(`(?:^|[\s\[])<\w+(?::\w+)?>(?:$|[\s\]])`)
+	rePlaceholder    = regexp.MustCompile(`^<(\w+)(?::(\w+))?>$`)
+)
+
+// -------------------------------------------------------
+
+type param struct {
+	name string
+	kind string
+}
+
+// compileGrammar converts a grammar into a regular expression anchored at both ends.  Grammars
+// containing placeholders e.g. "go build <pipeline:word> [<count:int>]" are translated into named
+// capture groups; all other grammars are treated as raw regular expressions.
+func compileGrammar(grammar string) (*regexp.Regexp, []param, error) {
+	if !reHasPlaceholder.MatchString(grammar) {
+		if !strings.HasPrefix(grammar, "^") {
+			grammar = "^" + grammar
+		}
+		if !strings.HasSuffix(grammar, "$") {
+			grammar = grammar + "$"
+		}
+
+		matcher, err := regexp.Compile(grammar)
+		return matcher, nil, err
+	}
+
+	pattern, params, err := compileTokens(grammar, tokenize(grammar))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	matcher, err := regexp.Compile("^" + pattern + "$")
+	return matcher, params, err
+}
+
+func compileTokens(grammar string, tokens []string) (string, []param, error) {
+	pattern := ""
+	params := []param{}
+
+	// leading is true until a required token is seen; optional tokens before it carry their own
+	// separator so the required token may start the message
+	leading := true
+
+	for _, token := range tokens {
+		optional := strings.HasPrefix(token, "[")
+		if optional {
+			if !strings.HasSuffix(token, "]") {
+				return "", nil, fmt.Errorf("grammar, %s, has unbalanced [ ]", grammar)
+			}
+			token = strings.TrimSpace(token[1 : len(token)-1])
+		}
+
+		var expr string
+		if optional {
+			inner, p, err := compileTokens(grammar, tokenize(token))
+			if err != nil {
+				return "", nil, err
+			}
+			expr = inner
+			params = append(params, p...)
+
+		} else if matches := rePlaceholder.FindStringSubmatch(token); matches != nil {
+			name, kind := matches[1], matches[2]
+			if kind == "" {
+				kind = defaultKind
+			}
+			k, found := Kinds[kind]
+			if !found {
+				return "", nil, fmt.Errorf("grammar, %s, contains unknown type, %s", grammar, kind)
+			}
+			expr = fmt.Sprintf("(?P<%s>%s)", name, k.Pattern)
+			params = append(params, param{name: name, kind: kind})
+
+		} else {
+			expr = regexp.QuoteMeta(token)
+		}
+
+		switch {
+		case optional && leading:
+			pattern = pattern + `(?:` + expr + `\s+)?`
+		case optional:
+			pattern = pattern + `(?:\s+` + expr + `)?`
+		case leading:
+			pattern = pattern + expr
+			leading = false
+		default:
+			pattern = pattern + `\s+` + expr
+		}
+	}
+
+	return pattern, params, nil
+}
+
+// tokenize splits a grammar on whitespace, keeping [optional] sections together
+func tokenize(grammar string) []string {
+	tokens := []string{}
+	depth := 0
+	current := ""
+
+	for _, r := range grammar {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case unicode.IsSpace(r) && depth == 0:
+			if current != "" {
+				tokens = append(tokens, current)
+			}
+			current = ""
+			continue
+		}
+		current = current + string(r)
+	}
+
+	if current != "" {
+		tokens = append(tokens, current)
+	}
+
+	return tokens
+}
@@ -0,0 +1,114 @@
+package gobot
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGrammar(t *testing.T) {
+	Convey("Given a command with typed placeholders", t, func() {
+		var pipeline string
+		var count int
+		command := &Command{
+			Grammar: "go build <pipeline:word> [<count:int>]",
+			Action: func(c *Context) {
+				pipeline = c.String("pipeline")
+				count = c.Int("count")
+				c.Respond("ok")
+			},
+		}
+		So(command.OnLoad(), ShouldBeNil)
+
+		Convey("When all placeholders are provided", func() {
+			resp, ok := command.OnMessage(&Context{Text: "go build FirstPipeline 3"})
+
+			Convey("Then I expect the values to be available by name", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "ok")
+				So(pipeline, ShouldEqual, "FirstPipeline")
+				So(count, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the optional placeholder is omitted", func() {
+			_, ok := command.OnMessage(&Context{Text: "go build FirstPipeline"})
+
+			Convey("Then I expect the zero value", func() {
+				So(ok, ShouldBeTrue)
+				So(pipeline, ShouldEqual, "FirstPipeline")
+				So(count, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a placeholder fails validation", func() {
+			resp, ok := command.OnMessage(&Context{Text: "go build FirstPipeline three"})
+
+			Convey("Then I expect the error to be returned to the user", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldEqual, "invalid count: expected a number, got 'three'")
+				So(pipeline, ShouldEqual, "")
+			})
+		})
+
+		Convey("Then I expect literals not to be treated as regular expressions", func() {
+			_, ok := command.OnMessage(&Context{Text: "go buildX FirstPipeline"})
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a grammar with a text placeholder", t, func() {
+		command := &Command{
+			Grammar: "say <message:text>",
+			Action:  func(c *Context) { c.Respond(c.String("message")) },
+		}
+		So(command.OnLoad(), ShouldBeNil)
+
+		resp, ok := command.OnMessage(&Context{Text: "say hello there world"})
+		So(ok, ShouldBeTrue)
+		So(resp.Text, ShouldEqual, "hello there world")
+	})
+
+	Convey("Given a grammar starting with an optional placeholder", t, func() {
+		var target string
+		command := &Command{
+			Grammar: "[<target>] deploy",
+			Action: func(c *Context) {
+				target = c.String("target")
+				c.Respond("ok")
+			},
+		}
+		So(command.OnLoad(), ShouldBeNil)
+
+		Convey("Then I expect it to match with the placeholder", func() {
+			_, ok := command.OnMessage(&Context{Text: "staging deploy"})
+			So(ok, ShouldBeTrue)
+			So(target, ShouldEqual, "staging")
+		})
+
+		Convey("Then I expect it to match without the placeholder", func() {
+			_, ok := command.OnMessage(&Context{Text: "deploy"})
+			So(ok, ShouldBeTrue)
+			So(target, ShouldEqual, "")
+		})
+	})
+
+	Convey("Given a raw regular expression with a named group", t, func() {
+		matcher, params, err := compileGrammar(`deploy (?P<env>\w+)`)
+
+		Convey("Then I expect it to be compiled as a regular expression", func() {
+			So(err, ShouldBeNil)
+			So(params, ShouldBeNil)
+			So(matcher.String(), ShouldEqual, `^deploy (?P<env>\w+)$`)
+			So(matcher.MatchString("deploy prod"), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a grammar with an unknown placeholder type", t, func() {
+		command := &Command{Grammar: "go build <pipeline:pipeline>"}
+
+		Convey("Then I expect OnLoad to fail", func() {
+			So(command.OnLoad(), ShouldNotBeNil)
+		})
+	})
+}
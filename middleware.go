@@ -0,0 +1,89 @@
+package gobot
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// -------------------------------------------------------
+
+// Middleware decorates a Handler with cross-cutting behavior e.g. logging or panic recovery
+type Middleware func(next Handler) Handler
+
+// MessageFunc has the same signature as Handler#OnMessage
+type MessageFunc func(*Context) (*Response, bool)
+
+// Wrap returns a Handler that handles messages with fn and delegates everything else to next.
+// Middleware will typically use Wrap to replace OnMessage
+func Wrap(next Handler, fn MessageFunc) Handler {
+	return &wrapped{
+		Handler: next,
+		fn:      fn,
+	}
+}
+
+type wrapped struct {
+	Handler
+	fn MessageFunc
+}
+
+func (w *wrapped) OnMessage(c *Context) (*Response, bool) {
+	return w.fn(c)
+}
+
+// Use decorates each handler with the middleware provided.  The first middleware is outermost
+// and sees each message first.
+func (h Handlers) Use(middleware ...Middleware) Handlers {
+	handlers := make(Handlers, len(h))
+
+	for i, handler := range h {
+		for j := len(middleware) - 1; j >= 0; j-- {
+			handler = middleware[j](handler)
+		}
+		handlers[i] = handler
+	}
+
+	return handlers
+}
+
+// -------------------------------------------------------
+
+// Recover converts a panicking Action into a failure response rather than crashing the process
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return Wrap(next, func(c *Context) (response *Response, ok bool) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.WithField("stage", "recover").Errorf("recovered from panic handling '%s' => %v\n%s", c.Text, r, debug.Stack())
+					c.Fail(fmt.Errorf("Sorry, something went wrong while running `%s`", c.Text))
+					response, ok = c.result()
+				}
+			}()
+
+			return next.OnMessage(c)
+		})
+	}
+}
+
+// Logger logs each message that was handled along with who sent it and how long it took
+func Logger() Middleware {
+	return func(next Handler) Handler {
+		return Wrap(next, func(c *Context) (*Response, bool) {
+			started := time.Now()
+
+			response, ok := next.OnMessage(c)
+			if ok {
+				log.WithFields(log.Fields{
+					"user":    c.User,
+					"text":    c.Text,
+					"elapsed": time.Now().Sub(started).String(),
+				}).Info("handled message")
+			}
+
+			return response, ok
+		})
+	}
+}
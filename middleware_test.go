@@ -0,0 +1,56 @@
+package gobot
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMiddleware(t *testing.T) {
+	Convey("Given a command that panics", t, func() {
+		handlers := Handlers{}.WithCommands(&Command{
+			Grammar: "boom",
+			Action:  func(c *Context) { panic("boom") },
+		})
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		Convey("When the handlers are decorated with Recover", func() {
+			resp, ok := handlers.Use(Recover()).OnMessage(&Context{Text: "boom"})
+
+			Convey("Then I expect a failure response rather than a panic", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldContainSubstring, "something went wrong")
+			})
+		})
+	})
+
+	Convey("Given multiple middleware", t, func() {
+		calls := []string{}
+		trace := func(name string) Middleware {
+			return func(next Handler) Handler {
+				return Wrap(next, func(c *Context) (*Response, bool) {
+					calls = append(calls, name)
+					return next.OnMessage(c)
+				})
+			}
+		}
+
+		handlers := Handlers{}.WithCommands(&Command{
+			Grammar: "hello",
+			Summary: "say hello",
+			Action:  func(c *Context) { c.Respond("world") },
+		}).Use(trace("first"), trace("second"))
+		So(handlers.OnLoad(), ShouldBeNil)
+
+		Convey("Then I expect the first middleware to be outermost", func() {
+			resp, ok := handlers.OnMessage(&Context{Text: "hello"})
+			So(ok, ShouldBeTrue)
+			So(resp.Text, ShouldEqual, "world")
+			So(calls, ShouldResemble, []string{"first", "second"})
+		})
+
+		Convey("Then I expect examples to pass through", func() {
+			So(len(handlers.Examples()), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,180 @@
+package gobot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// -------------------------------------------------------
+
+const (
+	DefaultSuggestionLimit = 2
+)
+
+// Suggestions is a Handler that replies with the closest matching commands when no other handler
+// understood the message.  As it matches every message, it should be added last in the chain.
+type Suggestions struct {
+	// Name is the name of the bot, used to render the suggested commands
+	Name string
+
+	// Handler provides the examples that messages are compared against
+	Handler Handler
+
+	// Limit is the maximum number of suggestions to offer; defaults to DefaultSuggestionLimit
+	Limit int
+}
+
+func (s *Suggestions) Examples() Examples {
+	return Examples{}
+}
+
+func (s *Suggestions) OnLoad() error {
+	return nil
+}
+
+func (s *Suggestions) OnMessage(c *Context) (*Response, bool) {
+	text := strings.TrimSpace(c.Text)
+	if text == "" || c.Action != "" {
+		return nil, false
+	}
+
+	response := c.Respond(fmt.Sprintf("Sorry, I don't understand `%s`.", text))
+
+	if suggestions := s.suggest(c, text); len(suggestions) > 0 {
+		response.Append("Did you mean:")
+		for _, e := range suggestions {
+			response.Append(fmt.Sprintf("* %s %s - %s", s.Name, e.Grammar, e.Summary))
+		}
+	}
+
+	response.Append(fmt.Sprintf("Try `%s help` for the full list of commands.", s.Name))
+	return response, true
+}
+
+type suggestion struct {
+	example  Example
+	distance int
+	overlap  int
+}
+
+func (s *Suggestions) suggest(c *Context, text string) Examples {
+	limit := s.Limit
+	if limit <= 0 {
+		limit = DefaultSuggestionLimit
+	}
+
+	words := strings.Fields(strings.ToLower(text))
+	seen := map[string]bool{}
+	candidates := []suggestion{}
+
+	for _, e := range s.Handler.Examples() {
+		if seen[e.Grammar] || !c.Allowed(e.Role) {
+			continue
+		}
+		seen[e.Grammar] = true
+
+		literals := grammarLiterals(e.Grammar)
+		if len(literals) == 0 {
+			continue
+		}
+
+		// compare the literal portion of the grammar against the same number of words of input
+		n := len(literals)
+		if n > len(words) {
+			n = len(words)
+		}
+		want := strings.Join(literals, " ")
+		got := strings.Join(words[0:n], " ")
+
+		distance := editDistance(want, got)
+		if distance > len(want)/3 {
+			continue
+		}
+
+		candidates = append(candidates, suggestion{
+			example:  e,
+			distance: distance,
+			overlap:  overlap(literals, words),
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].overlap > candidates[j].overlap
+	})
+
+	examples := Examples{}
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		examples = append(examples, candidates[i].example)
+	}
+	return examples
+}
+
+var reLiteral = regexp.MustCompile(`^[\w-]+$`)
+
+// grammarLiterals returns the leading literal words of a grammar i.e. up to the first placeholder,
+// optional section, or regular expression
+func grammarLiterals(grammar string) []string {
+	literals := []string{}
+	for _, token := range strings.Fields(strings.ToLower(grammar)) {
+		if !reLiteral.MatchString(token) {
+			break
+		}
+		literals = append(literals, token)
+	}
+	return literals
+}
+
+func overlap(literals, words []string) int {
+	count := 0
+	for _, l := range literals {
+		for _, w := range words {
+			if l == w {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and transpositions
+// required to turn a into b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,45 @@
+package gobot
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSuggestions(t *testing.T) {
+	Convey("Given a set of commands and a suggestions fallback", t, func() {
+		handlers := Handlers{}.WithCommands(
+			&Command{Grammar: "go build <pipeline>", Summary: "schedule a pipeline to run"},
+			&Command{Grammar: "go list", Summary: "list all pipelines"},
+			&Command{Grammar: "help", Summary: "list all grammars"},
+		)
+		suggestions := &Suggestions{Name: "gobot", Handler: handlers}
+
+		Convey("When the message contains a typo", func() {
+			resp, ok := suggestions.OnMessage(&Context{Text: "go biuld foo"})
+
+			Convey("Then I expect the closest command to be suggested", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldContainSubstring, "* gobot go build <pipeline> - schedule a pipeline to run")
+				So(resp.Text, ShouldNotContainSubstring, "go list")
+				So(resp.Text, ShouldContainSubstring, "`gobot help`")
+			})
+		})
+
+		Convey("When the message resembles nothing", func() {
+			resp, ok := suggestions.OnMessage(&Context{Text: "make me a sandwich"})
+
+			Convey("Then I expect only a pointer to help", func() {
+				So(ok, ShouldBeTrue)
+				So(resp.Text, ShouldNotContainSubstring, "Did you mean")
+				So(resp.Text, ShouldContainSubstring, "`gobot help`")
+			})
+		})
+	})
+
+	Convey("Then I expect transpositions to count as a single edit", t, func() {
+		So(editDistance("build", "biuld"), ShouldEqual, 1)
+		So(editDistance("list", "lst"), ShouldEqual, 1)
+		So(editDistance("", "go"), ShouldEqual, 2)
+	})
+}